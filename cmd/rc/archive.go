@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// zstdMagic starts every zstd stream
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func cmdArchive(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	fs := newFlagSet("archive")
+	output := fs.String("o", "", "archive to write: .tar, .tar.gz/.tgz or .tar.zst")
+	olderThan := fs.String("older-than", "", "only archive items trashed longer ago than this, e.g. 30d")
+	remove := fs.Bool("remove", false, "delete the archived items from the trash afterwards")
+	args = parseFlags(fs, userUI, args)
+
+	if *output == "" {
+		userUI.Error("Usage: rc archive [item]... [--older-than <age>] -o <file> [--remove]")
+		os.Exit(ExitUsage)
+	}
+
+	items, err := trashMgr.List()
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	var targets []trash.Item
+	var errs []error
+	if len(args) > 0 {
+		for _, target := range args {
+			item, ok := findItem(items, target)
+			if !ok {
+				userUI.Error(fmt.Sprintf("Item not found: %s", target))
+				errs = append(errs, fmt.Errorf("%w: %s", trash.ErrNotFound, target))
+				continue
+			}
+			targets = append(targets, item)
+		}
+	} else {
+		targets = items
+	}
+
+	if *olderThan != "" {
+		age, err := config.ParseDuration(*olderThan, config.Day)
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Invalid --older-than: %v", err))
+			os.Exit(ExitUsage)
+		}
+		cutoff := time.Now().Add(-age)
+		var old []trash.Item
+		for _, item := range targets {
+			if item.DeletedAt.Before(cutoff) {
+				old = append(old, item)
+			}
+		}
+		targets = old
+	}
+
+	if len(targets) == 0 {
+		userUI.Info("No items to archive")
+		os.Exit(batchExitCode(0, errs))
+	}
+
+	names := make([]string, len(targets))
+	for i, item := range targets {
+		names[i] = filepath.Base(item.TrashPath)
+	}
+	if err := writeArchive(trashMgr, *output, names); err != nil {
+		userUI.Error(fmt.Sprintf("Failed to write archive: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+	userUI.Success(fmt.Sprintf("Archived %d items to %s", len(targets), *output))
+
+	if *remove {
+		runBatch(userUI, targets, errs, "delete", "removed from trash", trashMgr.Remove)
+	}
+	os.Exit(batchExitCode(len(targets), errs))
+}
+
+func cmdUnarchive(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	fs := newFlagSet("unarchive")
+	report := fs.String("report", "", "write the items that could not be loaded to this file")
+	args = parseFlags(fs, userUI, args)
+
+	if len(args) != 1 {
+		userUI.Error("Usage: rc unarchive <file> [--report <file>]")
+		os.Exit(ExitUsage)
+	}
+
+	results, err := readArchive(trashMgr, args[0])
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to read archive: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+	reportConversion(userUI, results, "load", false, *report)
+}
+
+// writeArchive writes items to a new archive file, compressed as its name
+// says. A partly written file is removed.
+func writeArchive(trashMgr *trash.Manager, path string, names []string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		w, err := compressor(path, f)
+		if err != nil {
+			return err
+		}
+		if err := trashMgr.Archive(w, names); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// readArchive loads an archive file into the trash, detecting gzip and
+// zstd compression from its content
+func readArchive(trashMgr *trash.Manager, path string) ([]trash.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return trashMgr.Unarchive(zr)
+
+	case bytes.Equal(magic, zstdMagic):
+		cmd := exec.Command("zstd", "-d", "-q", "-c")
+		cmd.Stdin = br
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("zstd archives need the zstd command: %w", err)
+		}
+		results, err := trashMgr.Unarchive(out)
+		io.Copy(io.Discard, out)
+		if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+			err = fmt.Errorf("zstd: %w", waitErr)
+		}
+		return results, err
+	}
+	return trashMgr.Unarchive(br)
+}
+
+// compressor wraps w in the compression that the file name asks for
+func compressor(path string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(path, ".tar.zst"), strings.HasSuffix(path, ".tzst"):
+		return newZstdWriter(w)
+	case strings.HasSuffix(path, ".tar"):
+		return nopWriteCloser{w}, nil
+	}
+	return nil, errors.New("archive name must end in .tar, .tar.gz, .tgz or .tar.zst")
+}
+
+// zstdWriter compresses through the zstd command, as the standard library
+// has no zstd encoder
+type zstdWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	cmd := exec.Command("zstd", "-q", "-c")
+	cmd.Stdout = w
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("zstd archives need the zstd command: %w", err)
+	}
+	return &zstdWriter{WriteCloser: in, cmd: cmd}, nil
+}
+
+func (z *zstdWriter) Close() error {
+	err := z.WriteCloser.Close()
+	if waitErr := z.cmd.Wait(); waitErr != nil {
+		return fmt.Errorf("zstd: %w", waitErr)
+	}
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
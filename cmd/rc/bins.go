@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/project"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// openBins holds the managers this run has opened, by directory, and
+// lockedBins the release functions of the locks it holds
+var (
+	openBins   = map[string]*trash.Manager{}
+	lockedBins = map[string]func(){}
+)
+
+// openBin returns the manager of a bin, taking the bin's lock for the rest
+// of the run when lock is set. A project trash is created on first use.
+func openBin(bin config.Bin, lock bool) (*trash.Manager, error) {
+	trashMgr, ok := openBins[bin.Dir]
+	if !ok {
+		if bin.Name == config.ProjectBin {
+			if err := project.Prepare(bin.Paths[0]); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if trashMgr, err = trash.NewManagerAs(bin.Dir, trashOwner()); err != nil {
+			return nil, err
+		}
+		if err := unlockBin(trashMgr, bin); err != nil {
+			return nil, err
+		}
+		trashMgr.SetFreeFloor(bin.FreeFloor)
+		openBins[bin.Dir] = trashMgr
+	}
+
+	if lock && lockedBins[bin.Dir] == nil {
+		unlock, err := trashMgr.Lock()
+		if err != nil {
+			return nil, err
+		}
+		lockedBins[bin.Dir] = unlock
+	}
+	return trashMgr, nil
+}
+
+// projectBinFor returns the project trash of the checkout containing dir,
+// if project_trash or a marker file enables one there
+func projectBinFor(cfg *config.Config, dir string) (config.Bin, bool) {
+	root, ok := project.Root(dir)
+	if !ok {
+		return config.Bin{}, false
+	}
+
+	patterns := make([]string, len(cfg.ProjectTrash))
+	for i, p := range cfg.ProjectTrash {
+		patterns[i] = config.ExpandPath(p)
+	}
+	if !project.Enabled(root, patterns) {
+		return config.Bin{}, false
+	}
+
+	// Project trashes share the default bin's limits
+	bin, _ := cfg.LookupBin(config.DefaultBin)
+	bin.Name = config.ProjectBin
+	bin.Dir = project.TrashDir(root)
+	bin.Paths = []string{root}
+	return bin, true
+}
+
+// lookupBin finds a bin by name, including the project trash of the
+// checkout containing dir
+func lookupBin(cfg *config.Config, name, dir string) (config.Bin, bool) {
+	if name == config.ProjectBin {
+		return projectBinFor(cfg, dir)
+	}
+	return cfg.LookupBin(name)
+}
+
+// policyFor returns the retention, size and free space limits of a bin,
+// the retention rules that override them, and whether it shreds what they
+// purge
+func policyFor(cfg *config.Config, bin config.Bin) trash.Policy {
+	return trash.Policy{
+		MaxAge:    bin.Retention,
+		MaxSize:   bin.MaxSize,
+		MinFree:   bin.MinFree,
+		Largest:   bin.EvictLargest,
+		Shred:     shredIf(bin, bin.Shred),
+		MaxAgeFor: ruleRetention(cfg),
+	}
+}
+
+// purgeBin compresses aged items and applies a bin's limits, reporting
+// what was compressed and removed. Compression runs first, so that it can
+// bring the bin under its size limit.
+func purgeBin(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config, bin config.Bin) error {
+	now := time.Now()
+	compressed, err := trashMgr.Compress(trash.CompressPolicy{MinAge: bin.CompressAfter, MinSize: bin.CompressMinSize}, now)
+	if len(compressed) > 0 {
+		var saved int64
+		for _, item := range compressed {
+			saved += item.Size - item.StoredSize
+		}
+		userUI.Info(fmt.Sprintf("Compressed %d items (%s saved) in bin %s", len(compressed), formatSize(saved), bin.Name))
+	}
+	if err != nil {
+		return err
+	}
+
+	purged, err := trashMgr.Purge(policyFor(cfg, bin), now)
+	if len(purged) > 0 {
+		var size int64
+		for _, item := range purged {
+			size += item.DiskSize()
+		}
+		userUI.Info(fmt.Sprintf("Purged %d items (%s) from bin %s", len(purged), formatSize(size), bin.Name))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Purging can only free what the trash holds
+	if bin.MinFree > 0 {
+		if free, err := trashMgr.FreeSpace(); err == nil && free < bin.MinFree {
+			userUI.Info(fmt.Sprintf("Only %s free on the filesystem of bin %s, below min_free_space_mb (%s)", formatSize(free), bin.Name, formatSize(bin.MinFree)))
+		}
+	}
+	return nil
+}
+
+// expireDrops permanently deletes the items a bin has held for undo once
+// their grace period is over. The caller holds the bin's lock.
+func expireDrops(trashMgr *trash.Manager, userUI ui.UI, bin config.Bin) error {
+	expired, err := trashMgr.ExpireDrops(time.Now())
+	if len(expired) > 0 {
+		count := 0
+		for _, drop := range expired {
+			count += len(drop.Items)
+		}
+		userUI.Info(fmt.Sprintf("Deleted %d items held for undo in bin %s", count, bin.Name))
+	}
+	return err
+}
+
+func cmdBins(cfg *config.Config, active config.Bin) {
+	bins := cfg.Bins()
+	if active.Name == config.ProjectBin {
+		bins = append([]config.Bin{active}, bins...)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  BIN\tITEMS\tSIZE\tLIMIT\tRETENTION\tDIRECTORY")
+	for _, bin := range bins {
+		marker := " "
+		if bin.Name == active.Name {
+			marker = "*"
+		}
+
+		items, size := "-", "-"
+		// Listing must not create the directories of unused bins
+		if _, err := os.Stat(bin.Dir); err == nil {
+			if trashMgr, err := trash.NewManager(bin.Dir); err == nil {
+				if list, err := trashMgr.List(); err == nil {
+					items = fmt.Sprint(len(list))
+				}
+				if total, err := trashMgr.Size(); err == nil {
+					size = formatSize(total)
+				}
+			}
+		}
+
+		limit, retention := "none", "forever"
+		if bin.MaxSize > 0 {
+			limit = formatSize(bin.MaxSize)
+		}
+		if bin.Retention > 0 {
+			retention = config.FormatDuration(bin.Retention)
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\t%s\t%s\n", marker, bin.Name, items, size, limit, retention, bin.Dir)
+	}
+	w.Flush()
+}
+
+func cmdMoveBin(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config, source config.Bin, cwd string, args []string) {
+	if len(args) < 1 {
+		userUI.Error("Usage: rc move-bin [item]... <bin>")
+		os.Exit(ExitUsage)
+	}
+
+	destName := args[len(args)-1]
+	dest, ok := lookupBin(cfg, destName, cwd)
+	if !ok {
+		userUI.Error(fmt.Sprintf("Unknown bin: %s", destName))
+		os.Exit(ExitUsage)
+	}
+	if filepath.Clean(dest.Dir) == filepath.Clean(source.Dir) {
+		userUI.Error(fmt.Sprintf("Items are already in bin %s", dest.Name))
+		os.Exit(ExitUsage)
+	}
+
+	destMgr, err := openBin(dest, true)
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to open bin %s: %v", dest.Name, err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	targets, errs := selectTargets(trashMgr, userUI, args[:len(args)-1])
+	if targets == nil && errs == nil {
+		return
+	}
+
+	runBatch(userUI, targets, errs, "move", "moved to "+dest.Name, func(trashName string) error {
+		_, err := trashMgr.MoveTo(trashName, destMgr)
+		return err
+	})
+}
+
+func cmdEnforce(cfg *config.Config, userUI ui.UI) {
+	var errs []error
+	for _, bin := range cfg.Bins() {
+		if _, err := os.Stat(bin.Dir); err != nil {
+			continue
+		}
+
+		trashMgr, err := trash.NewManagerAs(bin.Dir, trashOwner())
+		if err == nil {
+			err = unlockBin(trashMgr, bin)
+		}
+		if err == nil {
+			var unlock func()
+			if unlock, err = trashMgr.Lock(); err == nil {
+				err = purgeBin(trashMgr, userUI, cfg, bin)
+				unlock()
+			}
+		}
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Failed to enforce limits on bin %s: %v", bin.Name, err))
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		userUI.Success("All bins are within their limits")
+	}
+	os.Exit(batchExitCode(len(cfg.Bins())-len(errs), errs))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// commands lists the subcommands offered by shell completion
+var commands = []struct {
+	name string
+	desc string
+}{
+	{"put", "Move files to trash"},
+	{"trash", "Move files to trash"},
+	{"rm", "Move files to trash"},
+	{"list", "List items in trash"},
+	{"ls", "List items in trash"},
+	{"restore", "Restore items from trash"},
+	{"browse", "Browse the trash full-screen"},
+	{"cat", "Print a trashed file"},
+	{"peek", "Show a trashed directory as a tree"},
+	{"extract", "Copy one file out of a trashed directory"},
+	{"diff", "Diff a trashed version against the current file"},
+	{"empty", "Permanently delete all items"},
+	{"remove", "Permanently delete items from trash"},
+	{"delete", "Permanently delete items from trash"},
+	{"undo", "Bring back the last removed or emptied items"},
+	{"unempty", "Bring back the last removed or emptied items"},
+	{"extend", "Push back when items are purged"},
+	{"pin", "Keep items from being purged"},
+	{"unpin", "Let limits purge items again"},
+	{"size", "Show trash size"},
+	{"bins", "List bins"},
+	{"move-bin", "Move items to another bin"},
+	{"enforce", "Purge items beyond bin limits"},
+	{"rules", "List retention rules or test a path"},
+	{"import", "Import items from another trash"},
+	{"export", "Export items to a freedesktop trash"},
+	{"archive", "Write items to a tarball"},
+	{"unarchive", "Load items from a tarball"},
+	{"config", "Manage configuration"},
+	{"completion", "Print a shell completion script"},
+	{"version", "Show version"},
+	{"help", "Show help"},
+}
+
+func cmdCompletion(userUI ui.UI, args []string) {
+	if len(args) != 1 {
+		userUI.Error("Usage: rc completion bash|zsh|fish")
+		os.Exit(ExitUsage)
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		userUI.Error(fmt.Sprintf("Unsupported shell: %s (expected bash, zsh or fish)", args[0]))
+		os.Exit(ExitUsage)
+	}
+}
+
+// cmdComplete implements the hidden "rc __complete <kind>" command that the
+// completion scripts call. It prints one candidate per line, optionally
+// followed by a tab and a description, and stays silent on errors so a
+// broken trash never garbles the user's command line.
+func cmdComplete(trashMgr *trash.Manager, args []string) {
+	if len(args) != 1 {
+		return
+	}
+
+	switch args[0] {
+	case "commands":
+		for _, c := range commands {
+			fmt.Printf("%s\t%s\n", c.name, c.desc)
+		}
+	case "config-keys":
+		for _, key := range config.Registry() {
+			fmt.Printf("%s\t%s\n", key.Name, key.Description)
+		}
+	case "bins":
+		cfg, _ := config.Load()
+		for _, bin := range cfg.Bins() {
+			fmt.Printf("%s\t%s\n", bin.Name, bin.Dir)
+		}
+	case "items":
+		items, err := trashMgr.List()
+		if err != nil {
+			return
+		}
+		seen := map[string]bool{}
+		for _, item := range items {
+			for _, candidate := range []string{item.OriginalPath, filepath.Base(item.TrashPath)} {
+				if !seen[candidate] {
+					seen[candidate] = true
+					fmt.Println(candidate)
+				}
+			}
+		}
+	}
+}
+
+const bashCompletion = `# bash completion for rc (GoCycled)
+# Load with: source <(rc completion bash)
+
+_rc() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local IFS=$'\n'
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "$(rc __complete commands 2>/dev/null | cut -f1)" -- "$cur"))
+        return
+    fi
+
+    if [[ ${COMP_WORDS[COMP_CWORD-1]} == --bin ]]; then
+        COMPREPLY=($(compgen -W "$(rc __complete bins 2>/dev/null | cut -f1)" -- "$cur"))
+        return
+    fi
+
+    case ${COMP_WORDS[1]} in
+        restore|remove|delete|pin|unpin|extend|cat|peek|extract|diff)
+            COMPREPLY=($(compgen -W "$(rc __complete items 2>/dev/null)" -- "$cur"))
+            ;;
+        move-bin)
+            COMPREPLY=($(compgen -W "$(rc __complete items 2>/dev/null; rc __complete bins 2>/dev/null | cut -f1)" -- "$cur"))
+            ;;
+        config)
+            if [[ $COMP_CWORD -eq 2 ]]; then
+                COMPREPLY=($(compgen -W $'get\nset\nreset\nvalidate' -- "$cur"))
+            elif [[ $COMP_CWORD -eq 3 && ( ${COMP_WORDS[2]} == get || ${COMP_WORDS[2]} == set ) ]]; then
+                COMPREPLY=($(compgen -W "$(rc __complete config-keys 2>/dev/null | cut -f1)" -- "$cur"))
+            fi
+            ;;
+        rules)
+            if [[ $COMP_CWORD -eq 2 ]]; then
+                COMPREPLY=($(compgen -W test -- "$cur"))
+            else
+                COMPREPLY=($(compgen -f -- "$cur"))
+            fi
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W $'bash\nzsh\nfish' -- "$cur"))
+            ;;
+        put|trash|rm)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            ;;
+    esac
+}
+
+complete -o filenames -F _rc rc
+`
+
+const zshCompletion = `#compdef rc
+# zsh completion for rc (GoCycled)
+# Load with: source <(rc completion zsh)
+
+_rc() {
+    local -a candidates
+
+    if (( CURRENT == 2 )); then
+        candidates=("${(@f)$(rc __complete commands 2>/dev/null)}")
+        candidates=("${candidates[@]//$'\t'/:}")
+        _describe -t commands 'rc command' candidates
+        return
+    fi
+
+    if [[ ${words[CURRENT-1]} == --bin ]]; then
+        candidates=("${(@f)$(rc __complete bins 2>/dev/null)}")
+        candidates=("${candidates[@]//$'\t'/:}")
+        _describe -t bins 'bin' candidates
+        return
+    fi
+
+    case ${words[2]} in
+        restore|remove|delete|pin|unpin|extend|cat|peek|extract|diff)
+            candidates=("${(@f)$(rc __complete items 2>/dev/null)}")
+            compadd -a candidates
+            ;;
+        move-bin)
+            candidates=("${(@f)$(rc __complete items 2>/dev/null)}")
+            compadd -a candidates
+            candidates=("${(@f)$(rc __complete bins 2>/dev/null)}")
+            candidates=("${candidates[@]//$'\t'/:}")
+            _describe -t bins 'bin' candidates
+            ;;
+        config)
+            if (( CURRENT == 3 )); then
+                compadd get set reset validate
+            elif (( CURRENT == 4 )) && [[ ${words[3]} == (get|set) ]]; then
+                candidates=("${(@f)$(rc __complete config-keys 2>/dev/null)}")
+                candidates=("${candidates[@]//$'\t'/:}")
+                _describe -t keys 'config key' candidates
+            fi
+            ;;
+        rules)
+            if (( CURRENT == 3 )); then
+                compadd test
+            else
+                _files
+            fi
+            ;;
+        completion)
+            compadd bash zsh fish
+            ;;
+        put|trash|rm)
+            _files
+            ;;
+    esac
+}
+
+if [[ ${zsh_eval_context[-1]} == loadautofunc ]]; then
+    _rc "$@"
+else
+    compdef _rc rc
+fi
+`
+
+const fishCompletion = `# fish completion for rc (GoCycled)
+# Load with: rc completion fish | source
+
+complete -c rc -f
+complete -c rc -n __fish_use_subcommand -a '(rc __complete commands 2>/dev/null)'
+complete -c rc -n '__fish_seen_subcommand_from restore remove delete pin unpin extend cat peek extract diff' -a '(rc __complete items 2>/dev/null)'
+complete -c rc -n '__fish_seen_subcommand_from put trash rm' -F
+complete -c rc -n '__fish_seen_subcommand_from move-bin' -a '(rc __complete items 2>/dev/null; rc __complete bins 2>/dev/null)'
+complete -c rc -l bin -x -a '(rc __complete bins 2>/dev/null)'
+complete -c rc -n '__fish_seen_subcommand_from config; and not __fish_seen_subcommand_from get set reset validate' -a 'get set reset validate'
+complete -c rc -n '__fish_seen_subcommand_from config; and __fish_seen_subcommand_from get set' -a '(rc __complete config-keys 2>/dev/null)'
+complete -c rc -n '__fish_seen_subcommand_from rules; and not __fish_seen_subcommand_from test' -a test
+complete -c rc -n '__fish_seen_subcommand_from rules; and __fish_seen_subcommand_from test' -F
+complete -c rc -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`
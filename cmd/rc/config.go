@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+func cmdConfig(cfg *config.Config, userUI ui.UI, args []string) {
+	flags := newFlagSet("config")
+	showOrigin := flags.Bool("show-origin", false, "show which layer each value came from")
+	// "set" takes no flags, and its value may look like one ("-5")
+	if len(args) == 0 || args[0] != "set" {
+		args = parseFlags(flags, userUI, args)
+	}
+
+	if len(args) == 0 {
+		// Show all config
+		fmt.Println("Current configuration:")
+		printConfig(cfg, *showOrigin)
+		fmt.Printf("\nConfig file: %s\n", config.ConfigPath())
+		return
+	}
+
+	subcommand := args[0]
+
+	switch subcommand {
+	case "get":
+		if len(args) < 2 {
+			userUI.Error("Usage: rc config get <key>")
+			os.Exit(ExitUsage)
+		}
+		key, ok := config.Lookup(args[1])
+		if !ok {
+			userUI.Error(fmt.Sprintf("Unknown config key: %s", args[1]))
+			os.Exit(ExitUsage)
+		}
+		if *showOrigin {
+			fmt.Printf("%s: %s (%s)\n", key.Name, key.Format(cfg.Get(key.Name)), cfg.Origin(key.Name))
+		} else {
+			fmt.Printf("%s: %s\n", key.Name, key.Format(cfg.Get(key.Name)))
+		}
+
+	case "set":
+		if len(args) < 3 {
+			userUI.Error("Usage: rc config set <key> <value>")
+			os.Exit(ExitUsage)
+		}
+		key, ok := config.Lookup(args[1])
+		if !ok {
+			userUI.Error(fmt.Sprintf("Unknown config key: %s", args[1]))
+			os.Exit(ExitUsage)
+		}
+
+		if err := cfg.SetString(key.Name, args[2]); err != nil {
+			userUI.Error(fmt.Sprintf("Invalid value: %v", err))
+			os.Exit(ExitUsage)
+		}
+
+		if err := saveConfig(cfg); err != nil {
+			userUI.Error(fmt.Sprintf("Failed to save config: %v", err))
+			os.Exit(exitCodeFor(err))
+		}
+
+		userUI.Success(fmt.Sprintf("Set %s = %s", key.Name, key.Format(cfg.Get(key.Name))))
+
+	case "reset":
+		backups, err := config.Reset()
+		if err == nil {
+			err = giveConfigToInvoker()
+		}
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Failed to reset config: %v", err))
+			os.Exit(exitCodeFor(err))
+		}
+		userUI.Success("Config reset to defaults")
+		for _, backup := range backups {
+			userUI.Info(fmt.Sprintf("Previous config saved to %s", backup))
+		}
+
+	case "validate":
+		checked, failed := 0, false
+		for _, path := range config.Files() {
+			errs := config.ValidateFile(path)
+			if len(errs) == 1 && errors.Is(errs[0], os.ErrNotExist) {
+				continue
+			}
+			checked++
+			for _, err := range errs {
+				userUI.Error(fmt.Sprintf("%s: %v", path, err))
+				failed = true
+			}
+			if len(errs) == 0 {
+				userUI.Success(fmt.Sprintf("%s is valid", path))
+			}
+		}
+		if failed {
+			os.Exit(ExitFailure)
+		}
+		if checked == 0 {
+			userUI.Info("No config files found, using defaults")
+		}
+
+	default:
+		userUI.Error(fmt.Sprintf("Unknown config subcommand: %s", subcommand))
+		os.Exit(ExitUsage)
+	}
+}
+
+// printConfig prints every config value, followed by its origin when
+// showOrigin is set
+func printConfig(cfg *config.Config, showOrigin bool) {
+	keys := config.Registry()
+	values := make([]string, len(keys))
+	valueWidth := 0
+	for i, key := range keys {
+		values[i] = key.Format(cfg.Get(key.Name))
+		valueWidth = max(valueWidth, len(values[i]))
+	}
+
+	for i, key := range keys {
+		if showOrigin {
+			fmt.Printf("  %-*s %-*s  %s\n", keyWidth()+1, key.Name+":", valueWidth, values[i], cfg.Origin(key.Name))
+		} else {
+			fmt.Printf("  %s: %s\n", key.Name, values[i])
+		}
+	}
+}
+
+// keyWidth returns the length of the longest config key name
+func keyWidth() int {
+	width := 0
+	for _, key := range config.Registry() {
+		width = max(width, len(key.Name))
+	}
+	return width
+}
+
+// configKeysHelp lists every config key with the values it accepts, for
+// the help text
+func configKeysHelp() string {
+	width := keyWidth()
+
+	var b strings.Builder
+	for _, key := range config.Registry() {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, key.Name, key.Description)
+		def := key.Default
+		if def == "" {
+			def = "none"
+		}
+		fmt.Fprintf(&b, "  %-*s  (%s, default %s)\n", width, "", key.Syntax(), def)
+	}
+	return b.String()
+}
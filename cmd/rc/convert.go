@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+func cmdImport(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	fs := newFlagSet("import")
+	from := fs.String("from", "", "format of the trash to import: freedesktop, trash-cli or json")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without changing anything")
+	report := fs.String("report", "", "write the items that could not be imported to this file")
+	args = parseFlags(fs, userUI, args)
+
+	if len(args) != 1 || *from == "" {
+		userUI.Error("Usage: rc import --from freedesktop|trash-cli|json <dir> [--dry-run] [--report <file>]")
+		os.Exit(ExitUsage)
+	}
+	format := checkFormat(userUI, *from, trash.ImportFormats)
+
+	results, err := trashMgr.Import(config.ExpandPath(args[0]), format, *dryRun)
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to import %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+	reportConversion(userUI, results, "import", *dryRun, *report)
+}
+
+func cmdExport(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	fs := newFlagSet("export")
+	to := fs.String("to", "", "format of the trash to write: freedesktop or trash-cli")
+	dryRun := fs.Bool("dry-run", false, "show what would be exported without changing anything")
+	report := fs.String("report", "", "write the items that could not be exported to this file")
+	args = parseFlags(fs, userUI, args)
+
+	if len(args) != 1 || *to == "" {
+		userUI.Error("Usage: rc export --to freedesktop|trash-cli <dir> [--dry-run] [--report <file>]")
+		os.Exit(ExitUsage)
+	}
+	format := checkFormat(userUI, *to, trash.ExportFormats)
+
+	results, err := trashMgr.Export(config.ExpandPath(args[0]), format, *dryRun)
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to export to %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+	reportConversion(userUI, results, "export", *dryRun, *report)
+}
+
+// checkFormat validates a --from or --to value
+func checkFormat(userUI ui.UI, name string, formats []trash.Format) trash.Format {
+	if !slices.Contains(formats, trash.Format(name)) {
+		names := make([]string, len(formats))
+		for i, f := range formats {
+			names[i] = string(f)
+		}
+		userUI.Error(fmt.Sprintf("Unknown format: %s (expected %s)", name, strings.Join(names, ", ")))
+		os.Exit(ExitUsage)
+	}
+	return trash.Format(name)
+}
+
+// reportConversion prints the outcome of an import or export, writes the
+// items that failed to reportPath if given, and exits
+func reportConversion(userUI ui.UI, results []trash.Result, verb string, dryRun bool, reportPath string) {
+	converted, duplicates := 0, 0
+	var errs []error
+	var report strings.Builder
+	for _, r := range results {
+		name := r.OriginalPath
+		if name == "" {
+			name = r.Source
+		}
+		switch {
+		case errors.Is(r.Err, trash.ErrDuplicate):
+			duplicates++
+			userUI.Info(fmt.Sprintf("Already in trash: %s", name))
+		case r.Err != nil:
+			errs = append(errs, r.Err)
+			userUI.Error(fmt.Sprintf("Failed to %s %s: %v", verb, name, r.Err))
+			fmt.Fprintf(&report, "%s\t%s\t%v\n", r.Source, r.OriginalPath, r.Err)
+		case dryRun:
+			converted++
+			userUI.Info(fmt.Sprintf("Would %s: %s -> %s", verb, name, r.Dest))
+		default:
+			converted++
+			userUI.Success(fmt.Sprintf("%s: %s", strings.ToUpper(verb[:1])+verb[1:]+"ed", name))
+		}
+	}
+
+	done := verb + "ed"
+	if dryRun {
+		done = "to " + verb
+	}
+	userUI.Info(fmt.Sprintf("%d %s, %d duplicates, %d failed", converted, done, duplicates, len(errs)))
+
+	if reportPath != "" {
+		if err := os.WriteFile(reportPath, []byte(report.String()), 0644); err != nil {
+			userUI.Error(fmt.Sprintf("Failed to write report: %v", err))
+			os.Exit(exitCodeFor(err))
+		}
+		if len(errs) > 0 {
+			userUI.Info(fmt.Sprintf("Items that could not be converted are listed in %s", reportPath))
+		}
+	}
+	os.Exit(batchExitCode(converted+duplicates, errs))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cj3636/GoCycled/pkg/diff"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// diffSide is one side of a comparison: a trashed item or a file on disk
+type diffSide struct {
+	label string
+	isDir bool
+	fsys  func() (fs.FS, error)
+	read  func() ([]byte, error)
+}
+
+func cmdDiff(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	flags := newFlagSet("diff")
+	context := flags.Int("context", diff.DefaultOptions.Context, "lines of context around each change")
+	args = parseFlags(flags, userUI, args)
+
+	if len(args) < 1 || len(args) > 2 {
+		userUI.Error("Usage: rc diff <item> [<other item>]")
+		os.Exit(ExitUsage)
+	}
+
+	items, err := trashMgr.List()
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	first, ok := newestVersion(items, args[0], "")
+	if !ok {
+		userUI.Error(fmt.Sprintf("Item not found: %s", args[0]))
+		os.Exit(ExitNotFound)
+	}
+
+	var a, b diffSide
+	if len(args) == 1 {
+		// Trashed version against whatever is at the original path now
+		a = trashedSide(trashMgr, first)
+		b, err = currentSide(first.OriginalPath)
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Nothing to compare at %s: %v", first.OriginalPath, err))
+			os.Exit(exitCodeFor(err))
+		}
+	} else {
+		// "rc diff f f" compares the two newest versions of f
+		second, ok := newestVersion(items, args[1], first.TrashPath)
+		if !ok {
+			userUI.Error(fmt.Sprintf("Item not found: %s", args[1]))
+			os.Exit(ExitNotFound)
+		}
+		if first.OriginalPath == second.OriginalPath && second.DeletedAt.Before(first.DeletedAt) {
+			first, second = second, first
+		}
+		a, b = trashedSide(trashMgr, first), trashedSide(trashMgr, second)
+	}
+
+	if err := compare(os.Stdout, userUI, a, b, diff.Options{Context: *context, Color: ui.ColorEnabled()}); err != nil {
+		userUI.Error(fmt.Sprintf("Failed to compare: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+// newestVersion returns the most recently deleted item matching target,
+// skipping the item at trash path exclude
+func newestVersion(items []trash.Item, target, exclude string) (trash.Item, bool) {
+	var candidates []trash.Item
+	for _, item := range items {
+		if item.TrashPath == exclude {
+			continue
+		}
+		if match, ok := findItem([]trash.Item{item}, target); ok {
+			candidates = append(candidates, match)
+		}
+	}
+	if len(candidates) == 0 {
+		return trash.Item{}, false
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].DeletedAt.After(candidates[j].DeletedAt)
+	})
+	return candidates[0], true
+}
+
+func trashedSide(trashMgr *trash.Manager, item trash.Item) diffSide {
+	name := filepath.Base(item.TrashPath)
+	return diffSide{
+		label: fmt.Sprintf("%s (trashed %s)", item.OriginalPath, item.DeletedAt.Format("2006-01-02 15:04:05")),
+		isDir: item.IsDir(),
+		fsys:  func() (fs.FS, error) { return trashMgr.ItemFS(name) },
+		read: func() ([]byte, error) {
+			r, err := trashMgr.Open(name, "")
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		},
+	}
+}
+
+func currentSide(path string) (diffSide, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return diffSide{}, err
+	}
+	return diffSide{
+		label: fmt.Sprintf("%s (current)", path),
+		isDir: info.IsDir(),
+		fsys:  func() (fs.FS, error) { return os.DirFS(path), nil },
+		read:  func() ([]byte, error) { return os.ReadFile(path) },
+	}, nil
+}
+
+// compare writes a unified diff for two files, a one-line verdict for
+// binary files and a recursive summary for two directories
+func compare(w io.Writer, userUI ui.UI, a, b diffSide, opts diff.Options) error {
+	if a.isDir != b.isDir {
+		userUI.Info(fmt.Sprintf("%s and %s are not the same type (file vs directory)", a.label, b.label))
+		return nil
+	}
+
+	if a.isDir {
+		return compareTrees(w, userUI, a, b)
+	}
+
+	aData, err := a.read()
+	if err != nil {
+		return err
+	}
+	bData, err := b.read()
+	if err != nil {
+		return err
+	}
+
+	if diff.IsBinary(aData) || diff.IsBinary(bData) {
+		if bytes.Equal(aData, bData) {
+			userUI.Info("No differences")
+		} else {
+			fmt.Fprintf(w, "Binary files %s and %s differ\n", a.label, b.label)
+		}
+		return nil
+	}
+
+	if !diff.Unified(w, a.label, b.label, diff.SplitLines(string(aData)), diff.SplitLines(string(bData)), opts) {
+		userUI.Info("No differences")
+	}
+	return nil
+}
+
+func compareTrees(w io.Writer, userUI ui.UI, a, b diffSide) error {
+	aFS, err := a.fsys()
+	if err != nil {
+		return err
+	}
+	bFS, err := b.fsys()
+	if err != nil {
+		return err
+	}
+
+	changes, err := diff.Trees(aFS, bFS)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		userUI.Info("No differences")
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", a.label, b.label)
+	counts := map[diff.ChangeKind]int{}
+	for _, c := range changes {
+		fmt.Fprintf(w, "%-13s %s\n", c.Kind, c.Path)
+		counts[c.Kind]++
+	}
+	fmt.Fprintf(w, "\n%d added, %d removed, %d modified, %d changed type\n",
+		counts[diff.Added], counts[diff.Removed], counts[diff.Modified], counts[diff.TypeChanged])
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// passphraseEnv holds the passphrase of encrypted bins without a key file,
+// for scripts
+const passphraseEnv = "RC_PASSPHRASE"
+
+// unlockBin gives an encrypted bin its key from the bin's key file or
+// RC_PASSPHRASE. Without either the bin stays locked: listing shows opaque
+// IDs, and requireKey asks for the passphrase when a command needs it.
+func unlockBin(trashMgr *trash.Manager, bin config.Bin) error {
+	if trashMgr.HasKey() || (!bin.Encrypt && !trashMgr.Encrypted()) {
+		return nil
+	}
+	if bin.KeyFile != "" {
+		data, err := os.ReadFile(bin.KeyFile)
+		if err != nil {
+			return fmt.Errorf("key file: %w", err)
+		}
+		return trashMgr.UseKey(bytes.TrimRight(data, "\r\n"))
+	}
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return trashMgr.UseKey([]byte(passphrase))
+	}
+	return nil
+}
+
+// requireKey makes sure an encrypted bin has its key before its items are
+// put, read or restored, asking for the passphrase if needed. A bin that
+// is not encrypted yet asks twice, since the passphrase cannot be changed.
+func requireKey(trashMgr *trash.Manager, userUI ui.UI, bin config.Bin) error {
+	if trashMgr.HasKey() || (!bin.Encrypt && !trashMgr.Encrypted()) {
+		return nil
+	}
+
+	passphrase, err := userUI.Passphrase(fmt.Sprintf("Passphrase for bin %s", bin.Name))
+	if err != nil {
+		return fmt.Errorf("%w (set key_file or %s)", trash.ErrNoKey, passphraseEnv)
+	}
+	if !trashMgr.Encrypted() {
+		again, err := userUI.Passphrase("Repeat passphrase")
+		if err != nil {
+			return err
+		}
+		if again != passphrase {
+			return errors.New("passphrases do not match")
+		}
+	}
+	return trashMgr.UseKey([]byte(passphrase))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// Exit codes returned by rc. These are part of the CLI contract and are
+// documented in the usage text, so existing values must not change.
+const (
+	ExitOK         = 0 // Every operation succeeded
+	ExitFailure    = 1 // Generic failure
+	ExitUsage      = 2 // Invalid command line
+	ExitPartial    = 3 // Some operations succeeded and some failed
+	ExitNotFound   = 4 // A file or trash item does not exist
+	ExitConflict   = 5 // Restoring would overwrite an existing file
+	ExitLockBusy   = 6 // The trash is locked by another rc process
+	ExitPermission = 7 // Permission denied, protected path, or missing or wrong key
+)
+
+// exitCodeFor maps an error returned by the trash package to an exit code
+func exitCodeFor(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, trash.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return ExitNotFound
+	case errors.Is(err, trash.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, trash.ErrLocked):
+		return ExitLockBusy
+	case errors.Is(err, trash.ErrProtected), errors.Is(err, fs.ErrPermission),
+		errors.Is(err, trash.ErrNoKey), errors.Is(err, trash.ErrWrongKey):
+		return ExitPermission
+	default:
+		return ExitFailure
+	}
+}
+
+// batchExitCode returns the exit code for a command that ran several
+// operations: ExitOK if none failed, ExitPartial if only some failed and the
+// code of the first error if all of them failed
+func batchExitCode(succeeded int, errs []error) int {
+	switch {
+	case len(errs) == 0:
+		return ExitOK
+	case succeeded > 0:
+		return ExitPartial
+	default:
+		return exitCodeFor(errs[0])
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// newFlagSet creates a flag set for a subcommand. Errors are reported by
+// parseFlags rather than printed by the flag package.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses args with fs and returns the positional arguments.
+// Unlike fs.Parse it allows flags after positional arguments, as in
+// "rc extract item src/main.go --to /tmp". Everything after "--" is
+// positional. Invalid flags are reported and exit with ExitUsage.
+func parseFlags(fs *flag.FlagSet, userUI ui.UI, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				printFlags(fs)
+				os.Exit(ExitOK)
+			}
+			userUI.Error(fmt.Sprintf("%s: %v", fs.Name(), err))
+			os.Exit(ExitUsage)
+		}
+
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+
+		// Parse stops at "--" (which it consumes) or at the first positional
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// listFlag collects the values of a flag that may be repeated or given a
+// comma-separated list, as in "--tag db --tag old" or "--tag db,old"
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(*l, v) {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// printFlags prints the flags accepted by a subcommand
+func printFlags(fs *flag.FlagSet) {
+	fmt.Printf("Flags for rc %s:\n", fs.Name())
+	fs.SetOutput(os.Stdout)
+	fs.PrintDefaults()
+}
+
+// override is a config value given as a global flag, as in
+// "rc --trash-dir /tmp/t list"
+type override struct {
+	key   string
+	value string
+	flag  string
+}
+
+// parseGlobalFlags splits the config flags that precede the command from
+// the command and its arguments. Every config key has a flag named after
+// it; bool keys also accept "--no-<key>" and need no value.
+func parseGlobalFlags(args []string) ([]override, []string, error) {
+	var overrides []override
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") && args[0] != "--" {
+		flag, value, hasValue := strings.Cut(args[0], "=")
+		name := flag
+		negated := strings.HasPrefix(flag, "--no-")
+		if negated {
+			name = "--" + strings.TrimPrefix(flag, "--no-")
+		}
+
+		key, ok := keyForFlag(name)
+		if !ok {
+			// Not a config flag, e.g. --help: leave it as the command
+			break
+		}
+
+		isBool := key.Type == "bool"
+		switch {
+		case negated && (!isBool || hasValue):
+			return nil, nil, fmt.Errorf("invalid flag: %s", args[0])
+		case negated:
+			value = "false"
+		case isBool && !hasValue:
+			value = "true"
+		case !hasValue:
+			if len(args) < 2 {
+				return nil, nil, fmt.Errorf("flag needs a value: %s", name)
+			}
+			value = args[1]
+			args = args[1:]
+		}
+
+		overrides = append(overrides, override{key: key.Name, value: value, flag: flag})
+		args = args[1:]
+	}
+	return overrides, args, nil
+}
+
+// keyForFlag returns the config key behind a global flag
+func keyForFlag(flag string) (config.Key, bool) {
+	for _, key := range config.Registry() {
+		if key.Flag() == flag {
+			return key, true
+		}
+	}
+	return config.Key{}, false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/git"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// gitCheck asks git about a path before it is trashed, as set by git_check.
+// It returns what to record with the item, whether git holds a copy so the
+// path may be deleted outright, and false if the user declined.
+func gitCheck(userUI ui.UI, cfg *config.Config, path string) (*trash.GitInfo, bool, bool) {
+	if cfg.GitCheck == "off" {
+		return nil, false, true
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, false, true
+	}
+
+	status, err := git.Check(path)
+	if err != nil || status.State == git.NotInRepo {
+		return nil, false, true
+	}
+	info := &trash.GitInfo{Root: status.Root, Commit: status.Head, Path: status.Path, State: status.State.String()}
+
+	var warning string
+	switch status.State {
+	case git.Modified:
+		warning = fmt.Sprintf("%s has uncommitted changes that git cannot restore", path)
+	case git.Untracked:
+		warning = fmt.Sprintf("%s was never committed to git", path)
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			warning = fmt.Sprintf("%s contains files that were never committed to git", path)
+		}
+	case git.Clean:
+		return info, cfg.GitSkipClean && status.Head != "", true
+	default:
+		return info, false, true
+	}
+
+	if cfg.GitCheck == "confirm" {
+		if !userUI.Confirm(warning + ". Trash anyway?") {
+			userUI.Info("Skipped: " + path)
+			return nil, false, false
+		}
+	} else {
+		userUI.Info("Warning: " + warning)
+	}
+	return info, false, true
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/paths"
+	"github.com/cj3636/GoCycled/pkg/project"
 	"github.com/cj3636/GoCycled/pkg/trash"
 	"github.com/cj3636/GoCycled/pkg/ui"
 )
@@ -13,46 +19,148 @@ import (
 const version = "1.0.0"
 
 func main() {
-	if len(os.Args) < 2 {
+	// Create UI
+	userUI := ui.NewBasicUI()
+
+	overrides, args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		userUI.Error(err.Error())
+		os.Exit(ExitUsage)
+	}
+	if len(args) < 1 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 
-	// Load config
-	cfg, err := config.Load()
+	// Parse command
+	command := args[0]
+	args = args[1:]
+
+	// Load config. A broken config stops everything except "rc config",
+	// which is how the user finds and fixes the problem.
+	cfg, err := loadConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		userUI.Error(fmt.Sprintf("Failed to load config: %v", err))
+		if command != "config" {
+			os.Exit(ExitFailure)
+		}
+	}
+	for _, o := range overrides {
+		if err := cfg.Override(o.key, o.value, "flag "+o.flag); err != nil {
+			userUI.Error(fmt.Sprintf("Invalid value for %s: %v", o.flag, err))
+			os.Exit(ExitUsage)
+		}
 	}
 
-	// Create UI
-	userUI := ui.NewBasicUI()
+	// rc config needs no trash, so a bin setting naming an unknown bin
+	// cannot keep the user from fixing it
+	if command == "config" {
+		cmdConfig(cfg, userUI, args)
+		return
+	}
 
-	// Create trash manager
-	trashMgr, err := trash.NewManager(cfg.TrashDir)
+	// Pick the bin: --bin, then the project trash of a git checkout, then
+	// a bin claiming the current directory
+	cwd, _ := os.Getwd()
+	global, err := cfg.ActiveBin(cwd)
 	if err != nil {
-		userUI.Error(fmt.Sprintf("Failed to initialize trash manager: %v", err))
-		os.Exit(1)
+		userUI.Error(err.Error())
+		os.Exit(ExitUsage)
+	}
+	bin := global
+	if projectBin, ok := projectBinFor(cfg, cwd); ok && !cfg.ExplicitBin() {
+		bin = projectBin
 	}
 
-	// Parse command
-	command := os.Args[1]
+	// Commands that modify the trash hold its lock for their whole run
+	lock := false
+	switch command {
+	case "put", "trash", "rm", "restore", "empty", "remove", "delete", "undo", "unempty", "pin", "unpin", "extend", "move-bin", "import", "export", "archive", "unarchive":
+		lock = true
+	}
+
+	trashMgr, err := openBin(bin, lock)
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to open trash: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	// Items held for undo go once their grace period is over, on the first
+	// run that can lock the bin. Read-only commands take the lock just for
+	// this and leave it to a later run while another rc holds it.
+	if command != "__complete" {
+		unlock := func() {}
+		if !lock {
+			unlock, err = trashMgr.Lock()
+		}
+		if err == nil {
+			if err := expireDrops(trashMgr, userUI, bin); err != nil {
+				userUI.Error(fmt.Sprintf("Failed to delete items held for undo: %v", err))
+			}
+			unlock()
+		}
+	}
+
+	// Reading and restoring sealed items needs the key
+	switch command {
+	case "restore", "browse", "cat", "peek", "extract", "diff", "pin", "unpin", "extend":
+		if err := requireKey(trashMgr, userUI, bin); err != nil {
+			userUI.Error(fmt.Sprintf("Failed to unlock bin %s: %v", bin.Name, err))
+			os.Exit(exitCodeFor(err))
+		}
+	}
 
 	switch command {
 	case "put", "trash", "rm":
-		cmdPut(trashMgr, userUI, cfg, os.Args[2:])
+		cmdPut(userUI, cfg, global, args)
 	case "list", "ls":
-		cmdList(trashMgr, userUI)
+		cmdList(listSections(bin, global, trashMgr), userUI, args)
 	case "restore":
-		cmdRestore(trashMgr, userUI, os.Args[2:])
+		cmdRestore(trashMgr, userUI, args)
 	case "empty":
-		cmdEmpty(trashMgr, userUI, cfg)
+		cmdEmpty(trashMgr, userUI, cfg, bin, args)
 	case "remove", "delete":
-		cmdRemove(trashMgr, userUI, os.Args[2:])
+		cmdRemove(trashMgr, userUI, cfg, bin, args)
+	case "undo", "unempty":
+		cmdUndo(trashMgr, userUI)
+	case "extend":
+		cmdExtend(trashMgr, userUI, bin, args)
+	case "pin":
+		cmdPin(trashMgr, userUI, args, true)
+	case "unpin":
+		cmdPin(trashMgr, userUI, args, false)
+	case "browse":
+		cmdBrowse(trashMgr, userUI, bin)
+	case "cat":
+		cmdCat(trashMgr, userUI, args)
+	case "peek":
+		cmdPeek(trashMgr, userUI, args)
+	case "extract":
+		cmdExtract(trashMgr, userUI, args)
+	case "diff":
+		cmdDiff(trashMgr, userUI, args)
 	case "size":
 		cmdSize(trashMgr, userUI)
-	case "config":
-		cmdConfig(cfg, userUI, os.Args[2:])
+	case "bins":
+		cmdBins(cfg, bin)
+	case "move-bin":
+		cmdMoveBin(trashMgr, userUI, cfg, bin, cwd, args)
+	case "enforce":
+		cmdEnforce(cfg, userUI)
+	case "import":
+		cmdImport(trashMgr, userUI, args)
+	case "export":
+		cmdExport(trashMgr, userUI, args)
+	case "archive":
+		cmdArchive(trashMgr, userUI, args)
+	case "unarchive":
+		cmdUnarchive(trashMgr, userUI, args)
+	case "rules":
+		cmdRules(cfg, userUI, args)
+	case "completion":
+		cmdCompletion(userUI, args)
+	case "__complete":
+		cmdComplete(trashMgr, args)
 	case "version", "--version", "-v":
 		fmt.Printf("rc version %s\n", version)
 	case "help", "--help", "-h":
@@ -60,85 +168,421 @@ func main() {
 	default:
 		userUI.Error(fmt.Sprintf("Unknown command: %s", command))
 		printUsage()
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 }
 
-func cmdPut(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config, args []string) {
+func cmdPut(userUI ui.UI, cfg *config.Config, global config.Bin, args []string) {
+	fs := newFlagSet("put")
+	note := fs.String("note", "", "why the files are trashed, shown by rc list --columns note")
+	var tags listFlag
+	fs.Var(&tags, "tag", "tag the items; repeat or separate with commas")
+	expire := fs.String("expire", "", "purge the items after this long instead of the bin's retention, e.g. 2d")
+	keepFor := fs.String("keep-for", "", "same as --expire, e.g. 90d")
+	args = parseFlags(fs, userUI, args)
+
+	var expiresAt time.Time
+	if *expire != "" && *keepFor != "" {
+		userUI.Error("Use either --expire or --keep-for")
+		os.Exit(ExitUsage)
+	}
+	if d := *expire + *keepFor; d != "" {
+		expiresAt = time.Now().Add(parseLifetime(userUI, d))
+	}
+
 	if len(args) == 0 {
 		userUI.Error("No files specified")
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 
+	trashed, skipped := 0, 0
+	var errs []error
+	used := map[string]config.Bin{}
 	for _, path := range args {
-		if err := trashMgr.Put(path); err != nil {
+		gitInfo, inGit, ok := gitCheck(userUI, cfg, path)
+		if !ok {
+			skipped++
+			continue
+		}
+		// Files in a checkout with a project trash stay in that checkout
+		bin := global
+		abs, _ := filepath.Abs(path)
+		if projectBin, ok := projectBinFor(cfg, filepath.Dir(abs)); ok && !cfg.ExplicitBin() {
+			bin = projectBin
+		}
+
+		// The first rule matching the path can keep it out of the trash,
+		// send it to another bin and set how long it is kept
+		rule, ruled := cfg.RuleFor(abs)
+		opts := trash.PutOptions{Git: gitInfo, Dedup: cfg.Dedup, Note: *note, Tags: tags, ExpiresAt: expiresAt}
+		if ruled {
+			if rule.Bin != "" && !cfg.ExplicitBin() {
+				ruleBin, ok := lookupBin(cfg, rule.Bin, filepath.Dir(abs))
+				if !ok {
+					err := fmt.Errorf("unknown bin: %s (from rule %s)", rule.Bin, rule.Match)
+					userUI.Error(fmt.Sprintf("Failed to trash %s: %v", path, err))
+					errs = append(errs, err)
+					continue
+				}
+				bin = ruleBin
+			}
+			if rule.Retention > 0 && opts.ExpiresAt.IsZero() {
+				opts.ExpiresAt = time.Now().Add(rule.Retention)
+			}
+		}
+
+		trashMgr, err := openBin(bin, true)
+		if err == nil && ruled && bypassesTrash(rule, abs) {
+			userUI.Info(fmt.Sprintf("Warning: rule %s deletes %s permanently instead of trashing it", rule.Match, path))
+			if err := trashMgr.Delete(path); err != nil {
+				userUI.Error(fmt.Sprintf("Failed to delete %s: %v", path, err))
+				errs = append(errs, err)
+				continue
+			}
+			userUI.Success(fmt.Sprintf("Deleted by rule %s: %s", rule.Match, path))
+			trashed++
+			continue
+		}
+		if err == nil && inGit {
+			// git_skip_clean: the last commit already has this content
+			if err := trashMgr.Delete(path); err != nil {
+				userUI.Error(fmt.Sprintf("Failed to delete %s: %v", path, err))
+				errs = append(errs, err)
+				continue
+			}
+			userUI.Success(fmt.Sprintf("Deleted clean file: %s (restore with: git -C %s checkout %s -- %s)", path, gitInfo.Root, gitInfo.Commit[:min(len(gitInfo.Commit), 12)], gitInfo.Path))
+			trashed++
+			continue
+		}
+		if err == nil {
+			err = requireKey(trashMgr, userUI, bin)
+		}
+		var item trash.Item
+		if err == nil {
+			item, err = trashMgr.PutWith(path, opts)
+		}
+		// Purging may make room above free_space_floor_mb
+		if errors.Is(err, trash.ErrNoSpace) {
+			if err = purgeBin(trashMgr, userUI, cfg, bin); err == nil {
+				item, err = trashMgr.PutWith(path, opts)
+			}
+		}
+		if err != nil {
 			userUI.Error(fmt.Sprintf("Failed to trash %s: %v", path, err))
+			errs = append(errs, err)
+			continue
+		}
+
+		userUI.Success(fmt.Sprintf("Moved to %s: %s", trashLabel(bin), path))
+		if ruled && rule.Compress {
+			if _, err := trashMgr.CompressItem(filepath.Base(item.TrashPath)); err != nil {
+				userUI.Error(fmt.Sprintf("Failed to compress %s: %v", path, err))
+			}
+		}
+		used[bin.Dir] = bin
+		trashed++
+	}
+
+	if len(args) > 1 || len(errs) > 0 {
+		if skipped > 0 {
+			userUI.Info(fmt.Sprintf("%d trashed, %d skipped, %d failed", trashed, skipped, len(errs)))
 		} else {
-			userUI.Success(fmt.Sprintf("Moved to trash: %s", path))
+			userUI.Info(fmt.Sprintf("%d trashed, %d failed", trashed, len(errs)))
+		}
+	}
+
+	for _, bin := range used {
+		trashMgr, _ := openBin(bin, true)
+		if err := purgeBin(trashMgr, userUI, cfg, bin); err != nil {
+			userUI.Error(fmt.Sprintf("Failed to enforce limits on bin %s: %v", bin.Name, err))
 		}
 	}
+	os.Exit(batchExitCode(trashed, errs))
 }
 
-func cmdList(trashMgr *trash.Manager, userUI ui.UI) {
-	items, err := trashMgr.List()
+// listSection is one trash shown by "rc list"
+type listSection struct {
+	title     string // Empty when the list has a single section
+	trashMgr  *trash.Manager
+	retention time.Duration // The bin's, for the time items have left
+}
+
+// listSections returns the trashes "rc list" shows: the project trash and
+// the global one inside a checkout with a project trash, else just the
+// active bin
+func listSections(bin, global config.Bin, trashMgr *trash.Manager) []listSection {
+	if bin.Name != config.ProjectBin {
+		return []listSection{{trashMgr: trashMgr, retention: bin.Retention}}
+	}
+
+	sections := []listSection{{title: "Project trash (" + bin.Paths[0] + ")", trashMgr: trashMgr, retention: bin.Retention}}
+	if globalMgr, err := openBin(global, false); err == nil {
+		sections = append(sections, listSection{title: "Global trash (bin " + global.Name + ")", trashMgr: globalMgr, retention: global.Retention})
+	}
+	return sections
+}
+
+func cmdList(sections []listSection, userUI ui.UI, args []string) {
+	fs := newFlagSet("list")
+	columns := fs.String("columns", "", "comma-separated columns: id,path,type,size,deleted,expires,batch,tags,note")
+	relative := fs.Bool("relative", false, "show deletion times relative to now (\"3h ago\")")
+	sortBy := fs.String("sort", "", "sort by date, size or path")
+	here := fs.Bool("here", false, "only show items deleted from the current project")
+	var tags listFlag
+	fs.Var(&tags, "tag", "only show items with this tag; repeat to require several")
+	pinned := fs.Bool("pinned", false, "only show pinned items")
+	search := fs.String("search", "", "only show items whose path, note or tags match this fuzzy query")
+	parseFlags(fs, userUI, args)
+
+	opts := ui.DefaultTableOptions()
+	opts.Relative = *relative
+	if *columns != "" {
+		parsed, err := ui.ParseColumns(*columns)
+		if err != nil {
+			userUI.Error(err.Error())
+			os.Exit(ExitUsage)
+		}
+		opts.Columns = parsed
+	}
+
+	var field ui.SortField
+	if *sortBy != "" {
+		var err error
+		if field, err = ui.ParseSortField(*sortBy); err != nil {
+			userUI.Error(err.Error())
+			os.Exit(ExitUsage)
+		}
+	}
+
+	// --here keeps the items that came from the current checkout, or from
+	// the current directory outside one
+	scope := ""
+	if *here {
+		cwd, _ := os.Getwd()
+		scope = cwd
+		if root, ok := project.Root(cwd); ok {
+			scope = root
+		}
+	}
+
+	for _, section := range sections {
+		items, err := section.trashMgr.List()
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
+			os.Exit(exitCodeFor(err))
+		}
+
+		if scope != "" {
+			items = itemsUnder(items, scope)
+		}
+		items = filterItems(items, tags, *pinned)
+		if *search != "" {
+			var matched []trash.Item
+			for _, r := range ui.NewMatcher().Rank(items, *search) {
+				matched = append(matched, r.Item)
+			}
+			items = matched
+		}
+		if *sortBy != "" {
+			ui.SortItems(items, field, false)
+		}
+
+		if section.title != "" {
+			fmt.Printf("%s:\n", section.title)
+		}
+		opts.Retention = section.retention
+		userUI.DisplayItems(items, opts)
+	}
+}
+
+// itemsUnder returns the items whose original path is inside dir
+func itemsUnder(items []trash.Item, dir string) []trash.Item {
+	var under []trash.Item
+	for _, item := range items {
+		if paths.Within(dir, item.OriginalPath) {
+			under = append(under, item)
+		}
+	}
+	return under
+}
+
+// filterItems returns the items that carry every tag, and only the pinned
+// ones if pinned is set
+func filterItems(items []trash.Item, tags []string, pinned bool) []trash.Item {
+	var kept []trash.Item
+	for _, item := range items {
+		if pinned && !item.Pinned {
+			continue
+		}
+		if !slices.ContainsFunc(tags, func(tag string) bool { return !item.HasTag(tag) }) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// parseLifetime parses how long an item is kept, as in "rc put --expire 2d",
+// exiting with ExitUsage unless it is a positive duration
+func parseLifetime(userUI ui.UI, s string) time.Duration {
+	d, err := config.ParseDuration(s, config.Day)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("duration must be positive: %q", s)
+	}
 	if err != nil {
-		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
-		os.Exit(1)
+		userUI.Error(err.Error())
+		os.Exit(ExitUsage)
+	}
+	return d
+}
+
+func cmdExtend(trashMgr *trash.Manager, userUI ui.UI, bin config.Bin, args []string) {
+	if len(args) < 1 {
+		userUI.Error("Usage: rc extend [item]... <duration>")
+		os.Exit(ExitUsage)
+	}
+	by := parseLifetime(userUI, args[len(args)-1])
+
+	targets, errs := selectTargets(trashMgr, userUI, args[:len(args)-1])
+	if targets == nil && errs == nil {
+		return
+	}
+	byName := map[string]trash.Item{}
+	for _, item := range targets {
+		byName[filepath.Base(item.TrashPath)] = item
+	}
+
+	// The expiry moves back from what it is now, or from now if it passed
+	now := time.Now()
+	runBatch(userUI, targets, errs, "extend", "extended by "+config.FormatDuration(by), func(trashName string) error {
+		expiry, ok := byName[trashName].Expiry(bin.Retention)
+		if !ok {
+			return errors.New("never expires")
+		}
+		if expiry.Before(now) {
+			expiry = now
+		}
+		return trashMgr.SetExpiry(trashName, expiry.Add(by))
+	})
+}
+
+func cmdPin(trashMgr *trash.Manager, userUI ui.UI, args []string, pinned bool) {
+	targets, errs := selectTargets(trashMgr, userUI, args)
+	if targets == nil && errs == nil {
+		return
 	}
 
-	userUI.DisplayItems(items)
+	verb, done := "pin", "pinned"
+	if !pinned {
+		verb, done = "unpin", "unpinned"
+	}
+	runBatch(userUI, targets, errs, verb, done, func(trashName string) error {
+		return trashMgr.SetPinned(trashName, pinned)
+	})
 }
 
 func cmdRestore(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	targets, errs := selectTargets(trashMgr, userUI, args)
+	if targets == nil && errs == nil {
+		return
+	}
+
+	runBatch(userUI, targets, errs, "restore", "restored", trashMgr.Restore)
+}
+
+// selectTargets resolves the items named in args by original path or trash
+// name, or lets the user pick several interactively when args is empty. Names
+// that match nothing are reported and returned as errors. It returns nil, nil
+// when the trash is empty.
+func selectTargets(trashMgr *trash.Manager, userUI ui.UI, args []string) ([]trash.Item, []error) {
 	items, err := trashMgr.List()
 	if err != nil {
 		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
-		os.Exit(1)
+		os.Exit(exitCodeFor(err))
 	}
 
 	if len(items) == 0 {
 		userUI.Info("Trash is empty")
-		return
+		return nil, nil
 	}
 
-	var trashName string
+	if len(args) == 0 {
+		// Interactive selection
+		selected, err := userUI.SelectItems(items)
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Selection failed: %v", err))
+			os.Exit(ExitFailure)
+		}
 
-	if len(args) > 0 {
-		// Restore by original path or trash name
-		targetPath := args[0]
+		chosen := map[string]bool{}
+		for _, path := range selected {
+			chosen[path] = true
+		}
+		var targets []trash.Item
 		for _, item := range items {
-			if item.OriginalPath == targetPath || filepath.Base(item.TrashPath) == targetPath {
-				trashName = filepath.Base(item.TrashPath)
-				break
+			if chosen[item.TrashPath] {
+				targets = append(targets, item)
 			}
 		}
-		if trashName == "" {
+		return targets, nil
+	}
+
+	var targets []trash.Item
+	var errs []error
+	for _, targetPath := range args {
+		item, ok := findItem(items, targetPath)
+		if !ok {
 			userUI.Error(fmt.Sprintf("Item not found: %s", targetPath))
-			os.Exit(1)
+			errs = append(errs, fmt.Errorf("%w: %s", trash.ErrNotFound, targetPath))
+			continue
 		}
-	} else {
-		// Interactive selection
-		selected, err := userUI.SelectItem(items)
-		if err != nil {
-			userUI.Error(fmt.Sprintf("Selection failed: %v", err))
-			os.Exit(1)
+		targets = append(targets, item)
+	}
+	return targets, errs
+}
+
+// findItem returns the item whose original path or trash name is target.
+// Relative paths are resolved against the working directory.
+func findItem(items []trash.Item, target string) (trash.Item, bool) {
+	absTarget, _ := filepath.Abs(target)
+	for _, item := range items {
+		if item.OriginalPath == target || item.OriginalPath == absTarget || filepath.Base(item.TrashPath) == target {
+			return item, true
 		}
-		trashName = filepath.Base(selected)
 	}
+	return trash.Item{}, false
+}
 
-	if err := trashMgr.Restore(trashName); err != nil {
-		userUI.Error(fmt.Sprintf("Failed to restore: %v", err))
-		os.Exit(1)
+// runBatch applies op to each target's trash name, reporting every result
+// and a summary, then exits with the batch exit code. errs holds failures
+// that happened before the batch started, such as unknown item names.
+func runBatch(userUI ui.UI, targets []trash.Item, errs []error, verb, done string, op func(trashName string) error) {
+	succeeded := 0
+	for _, item := range targets {
+		if err := op(filepath.Base(item.TrashPath)); err != nil {
+			userUI.Error(fmt.Sprintf("Failed to %s %s: %v", verb, item.OriginalPath, err))
+			errs = append(errs, err)
+		} else {
+			userUI.Success(fmt.Sprintf("%s: %s", strings.ToUpper(done[:1])+done[1:], item.OriginalPath))
+			succeeded++
+		}
 	}
 
-	userUI.Success("Item restored successfully")
+	if succeeded+len(errs) > 1 || len(errs) > 0 {
+		userUI.Info(fmt.Sprintf("%d %s, %d failed", succeeded, done, len(errs)))
+	}
+	os.Exit(batchExitCode(succeeded, errs))
 }
 
-func cmdEmpty(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config) {
+func cmdEmpty(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config, bin config.Bin, args []string) {
+	fs := newFlagSet("empty")
+	shred := fs.Bool("shred", bin.Shred, "overwrite the items before deleting them")
+	now := fs.Bool("now", false, "delete at once instead of holding the items for rc undo")
+	parseFlags(fs, userUI, args)
+
 	items, err := trashMgr.List()
 	if err != nil {
 		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
-		os.Exit(1)
+		os.Exit(exitCodeFor(err))
 	}
 
 	if len(items) == 0 {
@@ -153,137 +597,171 @@ func cmdEmpty(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config) {
 		}
 	}
 
-	if err := trashMgr.Empty(); err != nil {
+	if *shred {
+		userUI.Info(shredWarning)
+	}
+
+	switch {
+	case bin.Grace > 0 && !*now:
+		_, err = trashMgr.EmptyToPurgatory(time.Now(), bin.Grace, shredIf(bin, *shred))
+	case *shred:
+		opts, endProgress := shredWithProgress(bin)
+		err = trashMgr.ShredAll(opts)
+		endProgress()
+	default:
+		err = trashMgr.Empty()
+	}
+	if err != nil {
 		userUI.Error(fmt.Sprintf("Failed to empty trash: %v", err))
-		os.Exit(1)
+		os.Exit(exitCodeFor(err))
 	}
 
-	userUI.Success(fmt.Sprintf("Permanently deleted %d items", len(items)))
+	switch {
+	case bin.Grace > 0 && !*now:
+		userUI.Success(fmt.Sprintf("Deleted %d items; rc undo brings them back for %s", len(items), config.FormatDuration(bin.Grace)))
+	case *shred:
+		userUI.Success(fmt.Sprintf("Shredded %d items", len(items)))
+	default:
+		userUI.Success(fmt.Sprintf("Permanently deleted %d items", len(items)))
+	}
 }
 
-func cmdRemove(trashMgr *trash.Manager, userUI ui.UI, args []string) {
-	if len(args) == 0 {
-		userUI.Error("No item specified")
-		os.Exit(1)
-	}
+func cmdRemove(trashMgr *trash.Manager, userUI ui.UI, cfg *config.Config, bin config.Bin, args []string) {
+	fs := newFlagSet("remove")
+	shred := fs.Bool("shred", bin.Shred, "overwrite the items before deleting them")
+	now := fs.Bool("now", false, "delete at once instead of holding the items for rc undo")
+	args = parseFlags(fs, userUI, args)
 
-	items, err := trashMgr.List()
-	if err != nil {
-		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
-		os.Exit(1)
+	targets, errs := selectTargets(trashMgr, userUI, args)
+	if targets == nil && errs == nil {
+		return
 	}
 
-	targetPath := args[0]
-	var trashName string
-
-	for _, item := range items {
-		if item.OriginalPath == targetPath || filepath.Base(item.TrashPath) == targetPath {
-			trashName = filepath.Base(item.TrashPath)
-			break
+	// Interactive selections can cover many items, so confirm them
+	if len(args) == 0 && cfg.ConfirmDelete {
+		if !userUI.Confirm(fmt.Sprintf("Permanently delete %d items?", len(targets))) {
+			userUI.Info("Operation cancelled")
+			return
 		}
 	}
 
-	if trashName == "" {
-		userUI.Error(fmt.Sprintf("Item not found: %s", targetPath))
-		os.Exit(1)
+	if *shred {
+		userUI.Info(shredWarning)
+	}
+
+	if bin.Grace > 0 && !*now {
+		drop, err := trashMgr.NewDrop(time.Now(), bin.Grace, shredIf(bin, *shred))
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Failed to delete items: %v", err))
+			os.Exit(exitCodeFor(err))
+		}
+		userUI.Info(fmt.Sprintf("rc undo brings the items back for %s", config.FormatDuration(bin.Grace)))
+		runBatch(userUI, targets, errs, "delete", "deleted", func(trashName string) error {
+			return trashMgr.MoveToPurgatory(trashName, drop)
+		})
+		return
 	}
 
-	if err := trashMgr.Remove(trashName); err != nil {
-		userUI.Error(fmt.Sprintf("Failed to remove: %v", err))
-		os.Exit(1)
+	if !*shred {
+		runBatch(userUI, targets, errs, "delete", "permanently deleted", trashMgr.Remove)
+		return
 	}
 
-	userUI.Success("Item permanently deleted")
+	opts, endProgress := shredWithProgress(bin)
+	runBatch(userUI, targets, errs, "shred", "shredded", func(trashName string) error {
+		err := trashMgr.Shred(trashName, opts)
+		endProgress()
+		return err
+	})
 }
 
-func cmdSize(trashMgr *trash.Manager, userUI ui.UI) {
-	size, err := trashMgr.Size()
+func cmdUndo(trashMgr *trash.Manager, userUI ui.UI) {
+	drops, err := trashMgr.Drops()
 	if err != nil {
-		userUI.Error(fmt.Sprintf("Failed to calculate size: %v", err))
-		os.Exit(1)
+		userUI.Error(fmt.Sprintf("Failed to read deleted items: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+	if len(drops) == 0 {
+		userUI.Info("Nothing to undo")
+		return
 	}
 
-	userUI.Info(fmt.Sprintf("Trash size: %s", formatSize(size)))
+	// The last remove or empty comes back first
+	restored, err := trashMgr.Undo(drops[len(drops)-1])
+	for _, item := range restored {
+		userUI.Success(fmt.Sprintf("Back in trash: %s", item.OriginalPath))
+	}
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to undo: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
 }
 
-func cmdConfig(cfg *config.Config, userUI ui.UI, args []string) {
-	if len(args) == 0 {
-		// Show all config
-		fmt.Println("Current configuration:")
-		fmt.Printf("  trash_dir: %s\n", cfg.TrashDir)
-		fmt.Printf("  confirm_delete: %v\n", cfg.ConfirmDelete)
-		fmt.Printf("  auto_empty_days: %d\n", cfg.AutoEmptyDays)
-		fmt.Printf("  max_trash_size_mb: %d\n", cfg.MaxTrashSizeMB)
-		fmt.Printf("\nConfig file: %s\n", config.ConfigPath())
+func cmdBrowse(trashMgr *trash.Manager, userUI ui.UI, bin config.Bin) {
+	browser, ok := ui.NewTUI().(ui.Browser)
+	if !ok {
+		// Not a terminal: fall back to a plain listing
+		cmdList([]listSection{{trashMgr: trashMgr, retention: bin.Retention}}, userUI, nil)
 		return
 	}
 
-	subcommand := args[0]
-
-	switch subcommand {
-	case "get":
-		if len(args) < 2 {
-			userUI.Error("Usage: rc config get <key>")
-			os.Exit(1)
-		}
-		key := args[1]
-		value := cfg.Get(key)
-		if value == nil {
-			userUI.Error(fmt.Sprintf("Unknown config key: %s", key))
-			os.Exit(1)
-		}
-		fmt.Printf("%s: %v\n", key, value)
-
-	case "set":
-		if len(args) < 3 {
-			userUI.Error("Usage: rc config set <key> <value>")
-			os.Exit(1)
-		}
-		key := args[1]
-		value := args[2]
-
-		// Parse value based on key
-		var parsed interface{}
-		switch key {
-		case "trash_dir":
-			parsed = value
-		case "confirm_delete":
-			parsed = value == "true" || value == "yes" || value == "1"
-		case "auto_empty_days", "max_trash_size_mb":
-			var intVal int
-			if _, err := fmt.Sscanf(value, "%d", &intVal); err != nil {
-				userUI.Error(fmt.Sprintf("Invalid integer value: %s", value))
-				os.Exit(1)
+	// Each action takes the trash lock only while it runs so other rc
+	// processes aren't blocked for the whole browsing session
+	locked := func(action func(string) error) func(trash.Item) error {
+		return func(item trash.Item) error {
+			unlock, err := trashMgr.Lock()
+			if err != nil {
+				return err
 			}
-			parsed = intVal
-		default:
-			userUI.Error(fmt.Sprintf("Unknown config key: %s", key))
-			os.Exit(1)
+			defer unlock()
+			return action(filepath.Base(item.TrashPath))
 		}
+	}
 
-		if !cfg.Set(key, parsed) {
-			userUI.Error("Failed to set config value")
-			os.Exit(1)
+	// Deleting works as in rc remove: items are held for rc undo during the
+	// bin's grace period, all in one drop for the session, and shredded if
+	// the bin shreds
+	remove := trashMgr.Remove
+	if bin.Grace > 0 {
+		var drop *trash.Drop
+		remove = func(trashName string) error {
+			if drop == nil {
+				d, err := trashMgr.NewDrop(time.Now(), bin.Grace, shredIf(bin, bin.Shred))
+				if err != nil {
+					return err
+				}
+				drop = &d
+			}
+			return trashMgr.MoveToPurgatory(trashName, *drop)
 		}
-
-		if err := cfg.Save(); err != nil {
-			userUI.Error(fmt.Sprintf("Failed to save config: %v", err))
-			os.Exit(1)
+	} else if bin.Shred {
+		remove = func(trashName string) error {
+			return trashMgr.Shred(trashName, shredOptions(bin))
 		}
+	}
 
-		userUI.Success(fmt.Sprintf("Set %s = %v", key, parsed))
+	err := browser.Browse(ui.BrowseActions{
+		List:    trashMgr.List,
+		Restore: locked(trashMgr.Restore),
+		Remove:  locked(remove),
+	})
+	if err != nil && !errors.Is(err, ui.ErrCancelled) {
+		userUI.Error(fmt.Sprintf("Browse failed: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+}
 
-	case "reset":
-		defaultCfg := config.DefaultConfig()
-		if err := defaultCfg.Save(); err != nil {
-			userUI.Error(fmt.Sprintf("Failed to reset config: %v", err))
-			os.Exit(1)
-		}
-		userUI.Success("Config reset to defaults")
+func cmdSize(trashMgr *trash.Manager, userUI ui.UI) {
+	size, stored, err := trashMgr.Usage()
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to calculate size: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
 
-	default:
-		userUI.Error(fmt.Sprintf("Unknown config subcommand: %s", subcommand))
-		os.Exit(1)
+	if stored != size {
+		userUI.Info(fmt.Sprintf("Trash size: %s (%s on disk)", formatSize(size), formatSize(stored)))
+	} else {
+		userUI.Info(fmt.Sprintf("Trash size: %s", formatSize(size)))
 	}
 }
 
@@ -291,43 +769,192 @@ func printUsage() {
 	usage := `rc - Recycle Bin Utility (GoCycled)
 
 Usage:
-  rc <command> [arguments]
+  rc [global flags] <command> [arguments]
 
 Commands:
-  put, trash, rm <file>...  Move files to trash
-  list, ls                   List items in trash
-  restore [path]             Restore item from trash (interactive if no path)
-  empty                      Empty trash (permanently delete all items)
-  remove <path>              Permanently delete specific item from trash
+  put, trash, rm <file>... [--note <text>] [--tag <tag>]... [--expire <age>]
+                             Move files to trash; --expire (or --keep-for)
+                             purges them after <age> instead of the retention
+  list, ls [flags]           List items in trash
+  restore [path]...          Restore items from trash (interactive if no path)
+  browse                     Browse the trash in a full-screen view
+  cat <item> [inner/path]    Print a trashed file without restoring it
+  peek <item>                Show the contents of a trashed directory as a tree
+  extract <item> <inner/path> [--to <dest>]
+                             Copy one file out of a trashed directory
+  diff <item> [<other>]      Diff a trashed version against the current file
+                             or against another trashed version
+  empty [--shred] [--now]    Empty trash (permanently delete all items)
+  remove [path]... [--shred] [--now]
+                             Permanently delete items from trash (interactive if no path)
+  undo                       Bring back what the last empty or remove deleted
+                             (within grace_minutes)
+  extend [item]... <age>     Push back when items are purged
+  pin [item]...              Keep items from being purged by bin limits
+  unpin [item]...            Let bin limits purge items again
   size                       Show trash size
-  config [get|set|reset]     Manage configuration
+  bins                       List bins with their sizes and limits
+  move-bin [item]... <bin>   Move items to another bin
+  enforce                    Compress aged items, then purge items beyond each bin's
+                             retention and size limit
+  rules [test <path>...]     List the retention rules, or show which rule applies
+                             to each path
+  import --from <format> <dir>
+                             Move items from another trash into this one
+  export --to <format> <dir> Move items out to a freedesktop trash
+  archive [item]... -o <file> [--older-than <age>] [--remove]
+                             Write items with their metadata to a tarball
+  unarchive <file>           Load archived items back into the trash
+  config [get|set|reset|validate]
+                             Manage configuration
+  completion bash|zsh|fish   Print a shell completion script
   version                    Show version
   help                       Show this help
 
+Global Flags:
+  --<key> <value>            Override a config key for this run, e.g.
+                             --trash-dir /tmp/trash or --max-trash-size-mb 2GB
+  --<key> / --no-<key>       Turn a true/false key on or off
+  --bin <name>               Use a named bin (see "Bins" below)
+
+List Flags:
+  --columns id,path,...      Columns to show: id, path, type, size, deleted,
+                             expires, batch, tags, note
+  --relative                 Show deletion times as "3h ago"
+  --sort date|size|path      Sort the list
+  --here                     Only show items deleted from the current project
+  --tag <tag>                Only show items with this tag
+  --pinned                   Only show pinned items
+  --search <query>           Only show items whose path, note or tags match
+
+Import and Export Flags:
+  --from freedesktop|trash-cli|json
+                             Format of the trash to import
+  --to freedesktop|trash-cli Format of the trash to export to
+  --dry-run                  Show what would happen without changing anything
+  --report <file>            Write the items that could not be converted
+
 Config Commands:
-  rc config                  Show all config values
+  rc config [--show-origin]  Show all config values (and where each came from)
   rc config get <key>        Get a config value
   rc config set <key> <val>  Set a config value
   rc config reset            Reset config to defaults
+  rc config validate         Check the config file for unknown keys and bad values
 
 Configuration Keys:
-  trash_dir          Trash directory location
-  confirm_delete     Confirm before permanent deletion (true/false)
-  auto_empty_days    Auto-empty trash after N days
-  max_trash_size_mb  Maximum trash size in MB
-
+{{keys}}
 Examples:
   rc put file.txt              Move file.txt to trash
   rc list                      List all trashed items
-  rc restore                   Interactively restore an item
+  rc restore                   Interactively restore items (e.g. 1-3,7 or all or !4)
   rc restore file.txt          Restore specific file
+  rc browse                    Search, preview and restore interactively
+  rc list --columns id,path,size --relative
+  rc cat notes.txt             Print a trashed file
+  rc extract build src/main.go --to .
+  rc diff config.yaml          Compare trashed config.yaml with the current one
   rc empty                     Empty trash
+  rc --bin scratch put build/  Trash into the scratch bin
+  rc move-bin notes.txt work   Move a trashed item to the work bin
+  rc rules test ~/Downloads/x.iso
+                               Show which rule applies to a file
   rc config set confirm_delete true
   rc config get trash_dir
-
-Config file: ~/.trashrc
+  source <(rc completion bash)
+
+Exit Codes:
+  0  Success
+  1  Failure
+  2  Usage error
+  3  Partial failure (some files could not be processed)
+  4  File or trash item not found
+  5  Conflict (a file already exists at the restore location)
+  6  Trash is locked by another rc process
+  7  Permission denied, protected path, or missing or wrong key
+
+Bins:
+  Besides the default bin at trash_dir, config files can declare named bins:
+    "bins": {"scratch": {"dir": "~/.cache/rc-scratch", "retention": "7d",
+                         "max_size": "2GB", "paths": ["~/tmp"]}}
+  Commands use the bin given with --bin (or RC_BIN), else a bin whose paths
+  contain the current directory, else the "bin" config key. Each put purges
+  items past their own expiry or the bin's retention, then the oldest items
+  above its size. Pinned items are never purged.
+
+Rules:
+  An ordered list of globs in the config picks how rc put treats a file; the
+  first match applies:
+    "rules": [{"match": "*.iso", "delete": true},
+              {"match": "~/Downloads/**", "retention": "7d",
+               "max_size": "1GB", "delete": true}]
+  A rule can set retention, compress, bin (e.g. an encrypted one) or delete;
+  max_size limits delete to larger files. rc put warns before each file a
+  rule deletes. Purging honors rule retention too.
+
+Free Space:
+  With min_free_space_mb set, each put and rc enforce purge items while the
+  bin's filesystem has less free space than that: the oldest first, or the
+  largest with eviction set to largest. Items held for rc undo are deleted
+  first. Whatever copies data (encrypted puts, compression, unarchive, moves
+  across filesystems) is refused below free_space_floor_mb.
+
+Compression:
+  With compress_after_days set, items older than that and at least
+  compress_min_size_mb large are compressed in place (gzip, or tar.gz for
+  directories) whenever a bin's limits are applied. Restore, cat, peek, diff
+  and export read them transparently; rc size shows the size on disk too.
+
+Encrypted Bins:
+  A bin with "encrypt": true seals content and metadata with AES-256-GCM,
+  keyed from its "key_file", RC_PASSPHRASE or a passphrase prompt. Without
+  the key, rc list shows only opaque IDs.
+
+Deduplication:
+  With dedup on, identical trashed files of at least 4 KB are kept once in
+  the trash's blobs/ directory and shared by hardlink. Blobs are deleted when
+  no item uses them; restored files get a copy of their own. rc size shows
+  the logical size and the size on disk.
+
+Undo:
+  With grace_minutes set, rc empty and rc remove hold deleted items in the
+  trash's purgatory/ for that long, and rc undo (or rc unempty) brings back
+  the last batch. The first rc run after that deletes them for good; --now
+  skips the grace period.
+
+Shredding:
+  rc remove --shred and rc empty --shred (or shred on in the config or a
+  bin) overwrite files shred_passes times with zeros or random data
+  (shred_pattern) and rename them to random names before deleting them.
+  SSDs and copy-on-write filesystems may still keep old copies elsewhere.
+
+Project Trash:
+  Inside a git checkout with a .rc-project file at its root, or one matched
+  by the project_trash key, rc uses .rc-trash/ at the checkout root. Files
+  from the checkout are trashed there; rc list shows the project and global
+  trash separately. Use --bin to bypass the project trash.
+
+Git Checks:
+  Before trashing a file in a git work tree, rc warns if it has uncommitted
+  changes or was never committed (git_check=warn), asks first
+  (git_check=confirm) or says nothing (git_check=off). With git_skip_clean,
+  clean tracked files are deleted outright, since git holds a copy. The work
+  tree and HEAD commit are recorded with each trashed item.
+
+Sudo:
+  Under sudo, rc acts for the user who ran sudo: their config applies and
+  files go to their trash, labelled with their name. Set sudo_trash=root to
+  use root's own trash instead. Trashed files keep their owner, and restoring
+  as root gives it back.
+
+Config Files (later layers override earlier ones):
+  built-in defaults
+  /etc/gocycled/config
+  ~/.trashrc (still read for compatibility)
+  $XDG_CONFIG_HOME/gocycled/config (default ~/.config/gocycled/config)
+  RC_<KEY> environment variables, e.g. RC_TRASH_DIR
+  global flags
 `
-	fmt.Print(usage)
+	fmt.Print(strings.Replace(usage, "{{keys}}", configKeysHelp(), 1))
 }
 
 func formatSize(bytes int64) string {
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// resolveItem finds a single trashed item by original path or trash name,
+// the same way restore does, and exits if there is no such item
+func resolveItem(trashMgr *trash.Manager, userUI ui.UI, target string) trash.Item {
+	items, err := trashMgr.List()
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to list trash: %v", err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	item, ok := findItem(items, target)
+	if !ok {
+		userUI.Error(fmt.Sprintf("Item not found: %s", target))
+		os.Exit(ExitNotFound)
+	}
+	return item
+}
+
+func cmdCat(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		userUI.Error("Usage: rc cat <item> [inner/path]")
+		os.Exit(ExitUsage)
+	}
+
+	item := resolveItem(trashMgr, userUI, args[0])
+	inner := ""
+	if len(args) == 2 {
+		inner = args[1]
+	}
+
+	r, err := trashMgr.Open(filepath.Base(item.TrashPath), inner)
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to open %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		userUI.Error(fmt.Sprintf("Failed to read %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+func cmdPeek(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	if len(args) != 1 {
+		userUI.Error("Usage: rc peek <item>")
+		os.Exit(ExitUsage)
+	}
+
+	item := resolveItem(trashMgr, userUI, args[0])
+	if item.Git != nil {
+		userUI.Info(fmt.Sprintf("Trashed from git work tree %s", item.Git))
+	}
+	fsys, err := trashMgr.ItemFS(filepath.Base(item.TrashPath))
+	if errors.Is(err, trash.ErrNotDir) {
+		// Not a directory: describe the single file instead
+		userUI.Info(fmt.Sprintf("%s is a file (%s); use rc cat to view it", item.OriginalPath, formatSize(item.Size)))
+		return
+	}
+	if err != nil {
+		userUI.Error(fmt.Sprintf("Failed to open %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	if err := ui.RenderTree(os.Stdout, fsys, item.OriginalPath); err != nil {
+		userUI.Error(fmt.Sprintf("Failed to read %s: %v", args[0], err))
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+func cmdExtract(trashMgr *trash.Manager, userUI ui.UI, args []string) {
+	fs := newFlagSet("extract")
+	dest := fs.String("to", ".", "destination file or directory")
+	args = parseFlags(fs, userUI, args)
+
+	if len(args) != 2 {
+		userUI.Error("Usage: rc extract <item> <inner/path> [--to <dest>]")
+		os.Exit(ExitUsage)
+	}
+
+	item := resolveItem(trashMgr, userUI, args[0])
+	if err := trashMgr.Extract(filepath.Base(item.TrashPath), args[1], *dest); err != nil {
+		userUI.Error(fmt.Sprintf("Failed to extract %s: %v", args[1], err))
+		os.Exit(exitCodeFor(err))
+	}
+
+	userUI.Success(fmt.Sprintf("Extracted %s from %s to %s", args[1], item.OriginalPath, *dest))
+}
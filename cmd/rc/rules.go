@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// ruleRetention returns the retention the rules give items trashed from a
+// path, for trash.Policy.MaxAgeFor
+func ruleRetention(cfg *config.Config) func(string) (time.Duration, bool) {
+	rules := cfg.Rules()
+	return func(path string) (time.Duration, bool) {
+		for _, rule := range rules {
+			if rule.Matches(path) {
+				return rule.Retention, rule.Retention > 0
+			}
+		}
+		return 0, false
+	}
+}
+
+// bypassesTrash reports whether a rule deletes an existing path instead
+// of trashing it: always with delete, or above max_size if it has one
+func bypassesTrash(rule config.Rule, path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !rule.Delete {
+		return false
+	}
+	return rule.MaxSize == 0 || trash.PathSize(path, info) > rule.MaxSize
+}
+
+// describeRule summarizes what a rule does
+func describeRule(rule config.Rule) string {
+	if rule.Delete && rule.MaxSize == 0 {
+		return "delete instead of trashing"
+	}
+	var parts []string
+	if rule.MaxSize > 0 {
+		parts = append(parts, "delete above "+formatSize(rule.MaxSize))
+	}
+	if rule.Retention > 0 {
+		parts = append(parts, "keep "+config.FormatDuration(rule.Retention))
+	}
+	if rule.Compress {
+		parts = append(parts, "compress")
+	}
+	if rule.Bin != "" {
+		parts = append(parts, "bin "+rule.Bin)
+	}
+	if len(parts) == 0 {
+		return "trash as usual"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func cmdRules(cfg *config.Config, userUI ui.UI, args []string) {
+	rules := cfg.Rules()
+	if len(args) == 0 {
+		if len(rules) == 0 {
+			userUI.Info("No rules configured")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tMATCH\tACTION")
+		for i, rule := range rules {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, rule.Match, describeRule(rule))
+		}
+		w.Flush()
+		fmt.Printf("\nFrom %s; the first matching rule applies.\n", rules[0].Origin)
+		return
+	}
+
+	if args[0] != "test" || len(args) < 2 {
+		userUI.Error("Usage: rc rules [test <path>...]")
+		os.Exit(ExitUsage)
+	}
+	for _, path := range args[1:] {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			userUI.Error(fmt.Sprintf("Failed to resolve %s: %v", path, err))
+			os.Exit(ExitFailure)
+		}
+		matched := false
+		for i, rule := range rules {
+			if rule.Matches(abs) {
+				fmt.Printf("%s: rule %d (%s): %s\n", path, i+1, rule.Match, describeRule(rule))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fmt.Printf("%s: no rule matches; the bin's settings apply\n", path)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+	"github.com/cj3636/GoCycled/pkg/ui"
+)
+
+// shredWarning is shown whenever rc shreds on request, since overwriting
+// in place cannot promise what it seems to
+const shredWarning = "Shredding overwrites files in place; SSDs and copy-on-write filesystems (btrfs, ZFS, APFS) may keep old copies elsewhere"
+
+// shredOptions returns how a bin shreds items
+func shredOptions(bin config.Bin) trash.ShredOptions {
+	return trash.ShredOptions{Passes: bin.ShredPasses, Random: bin.ShredRandom}
+}
+
+// shredIf returns a bin's shred options when shred is set, or nil to
+// delete plainly, for deletions that happen later: purging and the end of a
+// grace period
+func shredIf(bin config.Bin, shred bool) *trash.ShredOptions {
+	if !shred {
+		return nil
+	}
+	opts := shredOptions(bin)
+	return &opts
+}
+
+// shredWithProgress returns a bin's shred options reporting progress on the
+// terminal, and a function that ends the progress line before the next
+// message
+func shredWithProgress(bin config.Bin) (trash.ShredOptions, func()) {
+	opts := shredOptions(bin)
+	if ui.TerminalWidth() == 0 {
+		return opts, func() {}
+	}
+
+	shown := -1
+	opts.Progress = func(done, total int64) {
+		percent := 100
+		if total > 0 {
+			percent = int(done * 100 / total)
+		}
+		if percent != shown {
+			shown = percent
+			fmt.Fprintf(os.Stdout, "\rShredding: %3d%% (%s of %s)", percent, formatSize(done), formatSize(total))
+		}
+	}
+	return opts, func() {
+		if shown >= 0 {
+			fmt.Fprintln(os.Stdout)
+			shown = -1
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cj3636/GoCycled/pkg/config"
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// sudoUser is the user who ran rc through sudo
+type sudoUser struct {
+	name  string
+	home  string
+	owner trash.Owner
+}
+
+// invoker is the user rc acts for under sudo, or nil. Trash directories,
+// metadata and config files that rc creates are given to them.
+var invoker *sudoUser
+
+// rootTrash is set when rc runs under sudo but uses root's own trash, as
+// sudo_trash=root asks
+var rootTrash bool
+
+// invokingUser returns the user who ran rc through sudo, if rc runs as root
+// under sudo for someone other than root
+func invokingUser() (*sudoUser, bool) {
+	if os.Geteuid() != 0 {
+		return nil, false
+	}
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil || uid == 0 {
+		return nil, false
+	}
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return nil, false
+	}
+
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil || u.HomeDir == "" {
+		return nil, false
+	}
+	return &sudoUser{name: u.Username, home: u.HomeDir, owner: trash.Owner{UID: uid, GID: gid}}, true
+}
+
+// loadConfig loads the config of the user rc acts for. Under sudo that is
+// the user who ran sudo, so "~" and the config files are theirs, unless
+// their sudo_trash key asks for root's own trash.
+func loadConfig() (*config.Config, error) {
+	sudoer, ok := invokingUser()
+	if !ok {
+		return config.Load()
+	}
+
+	rootHome := os.Getenv("HOME")
+	os.Setenv("HOME", sudoer.home)
+	cfg, err := config.Load()
+	if cfg.SudoTrash == "root" {
+		os.Setenv("HOME", rootHome)
+		rootTrash = true
+		return config.Load()
+	}
+	invoker = sudoer
+	return cfg, err
+}
+
+// trashOwner returns the owner for trash directories and metadata, or nil
+// to leave them to the current user
+func trashOwner() *trash.Owner {
+	if invoker == nil {
+		return nil
+	}
+	return &invoker.owner
+}
+
+// giveToInvoker hands a file rc created on the invoking user's behalf back
+// to them, so it stays usable without sudo
+func giveToInvoker(path string) error {
+	if invoker == nil {
+		return nil
+	}
+	return os.Lchown(path, invoker.owner.UID, invoker.owner.GID)
+}
+
+// saveConfig saves the config, keeping the file and its directory owned by
+// the invoking user under sudo
+func saveConfig(cfg *config.Config) error {
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	return giveConfigToInvoker()
+}
+
+// giveConfigToInvoker hands the user config file, and the directories Save
+// may have created for it inside their home, to the invoking user
+func giveConfigToInvoker() error {
+	if invoker == nil {
+		return nil
+	}
+	path := config.ConfigPath()
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, invoker.home+"/"); dir = filepath.Dir(dir) {
+		if err := giveToInvoker(dir); err != nil {
+			return err
+		}
+	}
+	return giveToInvoker(path)
+}
+
+// trashLabel names a bin in messages, making clear whose trash it is
+func trashLabel(bin config.Bin) string {
+	label := "trash"
+	if bin.Name == config.ProjectBin {
+		label = "project trash"
+	}
+	switch {
+	case invoker != nil:
+		return invoker.name + "'s " + label
+	case rootTrash:
+		return "root's " + label
+	}
+	return label
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/paths"
+)
+
+// DefaultBin is the name of the bin kept at trash_dir
+const DefaultBin = "default"
+
+// ProjectBin is the name of the trash kept in a git checkout, see
+// project_trash
+const ProjectBin = "project"
+
+// binsKey holds the named bins in config files
+const binsKey = "bins"
+
+// Bin is a trash bin with its own directory, retention and size limit
+type Bin struct {
+	Name      string
+	Dir       string
+	Retention time.Duration // Items older than this are purged; 0 keeps them
+	MaxSize   int64         // Items are evicted above this many bytes; 0 means no limit
+	Paths     []string      // Directories whose commands use this bin by default
+
+	CompressAfter   time.Duration // Items older than this are compressed; 0 never compresses
+	CompressMinSize int64         // Smaller items are never compressed
+
+	Encrypt bool   // Items and their metadata are sealed with a key
+	KeyFile string // File holding the key's secret; a passphrase is asked for otherwise
+
+	Shred       bool // Permanent deletion overwrites items first
+	ShredPasses int  // Times each file is overwritten
+	ShredRandom bool // Overwrite with random data instead of zeros
+
+	Grace time.Duration // Deleted items wait this long in purgatory; 0 deletes at once
+
+	MinFree   int64 // Items are evicted while the filesystem has less free space; 0 means no minimum
+	FreeFloor int64 // Copies of data the trash writes must leave this much free space; 0 means no floor
+
+	EvictLargest bool // MaxSize and MinFree evict the largest items first instead of the oldest
+}
+
+// binSpec is a bin as written in a config file:
+//
+//	"bins": {
+//	  "scratch": {"dir": "~/.cache/rc-scratch", "retention": "7d", "max_size": "2GB", "paths": ["~/tmp"]}
+//	}
+//
+// Retention, max_size, compress_after, compress_min_size and shred fall
+// back to auto_empty_days, max_trash_size_mb, compress_after_days,
+// compress_min_size_mb and shred.
+type binSpec struct {
+	Dir             string   `json:"dir"`
+	Retention       string   `json:"retention,omitempty"`
+	MaxSize         string   `json:"max_size,omitempty"`
+	Paths           []string `json:"paths,omitempty"`
+	CompressAfter   string   `json:"compress_after,omitempty"`
+	CompressMinSize string   `json:"compress_min_size,omitempty"`
+	Encrypt         bool     `json:"encrypt,omitempty"`
+	KeyFile         string   `json:"key_file,omitempty"`
+	Shred           *bool    `json:"shred,omitempty"`
+}
+
+// binSource records which file declared a bin
+type binSource struct {
+	spec   binSpec
+	origin string
+	user   bool
+}
+
+var binNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Bins returns every bin, the default bin first and the rest by name
+func (c *Config) Bins() []Bin {
+	bins := []Bin{c.defaultBin()}
+	names := make([]string, 0, len(c.bins))
+	for name := range c.bins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bins = append(bins, c.resolveBin(name, c.bins[name].spec))
+	}
+	return bins
+}
+
+// LookupBin returns the bin with the given name
+func (c *Config) LookupBin(name string) (Bin, bool) {
+	if name == DefaultBin {
+		return c.defaultBin(), true
+	}
+	src, ok := c.bins[name]
+	if !ok {
+		return Bin{}, false
+	}
+	return c.resolveBin(name, src.spec), true
+}
+
+// ActiveBin picks the bin for a command run in dir: a bin named with --bin
+// or RC_BIN, then a bin whose paths contain dir, then the configured bin
+func (c *Config) ActiveBin(dir string) (Bin, error) {
+	if !c.ExplicitBin() {
+		if bin, ok := c.binForDir(dir); ok {
+			return bin, nil
+		}
+	}
+
+	bin, ok := c.LookupBin(c.BinName)
+	if !ok {
+		return Bin{}, fmt.Errorf("unknown bin: %s (from %s)", c.BinName, c.Origin("bin"))
+	}
+	return bin, nil
+}
+
+// ExplicitBin reports whether the bin was chosen for this run, with --bin
+// or RC_BIN, rather than by a config file
+func (c *Config) ExplicitBin() bool {
+	origin := c.Origin("bin")
+	return strings.HasPrefix(origin, "flag ") || strings.HasPrefix(origin, "env ")
+}
+
+// binForDir returns the bin with the longest path containing dir
+func (c *Config) binForDir(dir string) (Bin, bool) {
+	var best Bin
+	bestLen := -1
+	for _, bin := range c.Bins() {
+		for _, p := range bin.Paths {
+			if paths.Within(p, dir) && len(p) > bestLen {
+				best, bestLen = bin, len(p)
+			}
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// defaultBin returns the bin at trash_dir, limited by the global keys
+func (c *Config) defaultBin() Bin {
+	return Bin{
+		Name:      DefaultBin,
+		Dir:       c.TrashDir,
+		Retention: time.Duration(c.AutoEmptyDays) * Day,
+		MaxSize:   int64(c.MaxTrashSizeMB) * MB,
+
+		CompressAfter:   time.Duration(c.CompressAfterDays) * Day,
+		CompressMinSize: int64(c.CompressMinSizeMB) * MB,
+
+		Shred:       c.Shred,
+		ShredPasses: c.ShredPasses,
+		ShredRandom: c.ShredPattern == "random",
+
+		Grace: time.Duration(c.GraceMinutes) * time.Minute,
+
+		MinFree:   int64(c.MinFreeSpaceMB) * MB,
+		FreeFloor: int64(c.FreeSpaceFloorMB) * MB,
+
+		EvictLargest: c.Eviction == "largest",
+	}
+}
+
+// resolveBin turns a validated spec into a Bin, filling in the global
+// limits it leaves out
+func (c *Config) resolveBin(name string, spec binSpec) Bin {
+	bin := c.defaultBin()
+	bin.Name = name
+	bin.Dir = ExpandPath(spec.Dir)
+	if spec.Retention != "" {
+		bin.Retention, _ = ParseDuration(spec.Retention, Day)
+	}
+	if spec.MaxSize != "" {
+		bin.MaxSize, _ = ParseSize(spec.MaxSize, MB)
+	}
+	if spec.CompressAfter != "" {
+		bin.CompressAfter, _ = ParseDuration(spec.CompressAfter, Day)
+	}
+	if spec.CompressMinSize != "" {
+		bin.CompressMinSize, _ = ParseSize(spec.CompressMinSize, MB)
+	}
+	bin.Encrypt = spec.Encrypt
+	if spec.Shred != nil {
+		bin.Shred = *spec.Shred
+	}
+	if spec.KeyFile != "" {
+		bin.KeyFile = ExpandPath(spec.KeyFile)
+	}
+	for _, p := range spec.Paths {
+		bin.Paths = append(bin.Paths, filepath.Clean(ExpandPath(p)))
+	}
+	return bin
+}
+
+// applyBins records the bins declared in a config file. A bin declared
+// again in a later file replaces the earlier declaration.
+func (c *Config) applyBins(raw json.RawMessage, origin string, user bool) []error {
+	specs, errs := decodeBins(raw)
+	if c.bins == nil {
+		c.bins = make(map[string]binSource)
+	}
+	for name, spec := range specs {
+		c.bins[name] = binSource{spec: spec, origin: origin, user: user}
+	}
+	return errs
+}
+
+// userBins returns the bins that belong in the user config file
+func (c *Config) userBins() map[string]binSpec {
+	specs := map[string]binSpec{}
+	for name, src := range c.bins {
+		if src.user {
+			specs[name] = src.spec
+		}
+	}
+	return specs
+}
+
+// decodeBins parses and validates the "bins" object of a config file. It
+// returns the valid bins and an error for each invalid one.
+func decodeBins(raw json.RawMessage) (map[string]binSpec, []error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, []error{fmt.Errorf("%s: expected an object of bins", binsKey)}
+	}
+
+	specs := map[string]binSpec{}
+	var errs []error
+	for name, entry := range entries {
+		spec, err := decodeBin(name, entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		specs[name] = spec
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return specs, errs
+}
+
+func decodeBin(name string, raw json.RawMessage) (binSpec, error) {
+	if name == DefaultBin || name == ProjectBin {
+		return binSpec{}, fmt.Errorf("bin name %q is reserved", name)
+	}
+	if !binNamePattern.MatchString(name) {
+		return binSpec{}, fmt.Errorf("invalid bin name: %q", name)
+	}
+
+	var spec binSpec
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return binSpec{}, fmt.Errorf("bin %s: %v", name, err)
+	}
+
+	if strings.TrimSpace(spec.Dir) == "" {
+		return binSpec{}, fmt.Errorf("bin %s: dir must not be empty", name)
+	}
+	if spec.Retention != "" {
+		if d, err := ParseDuration(spec.Retention, Day); err != nil || d < 0 {
+			return binSpec{}, fmt.Errorf("bin %s: invalid retention %q", name, spec.Retention)
+		}
+	}
+	if spec.MaxSize != "" {
+		if size, err := ParseSize(spec.MaxSize, MB); err != nil || size < 0 {
+			return binSpec{}, fmt.Errorf("bin %s: invalid max_size %q", name, spec.MaxSize)
+		}
+	}
+	if spec.CompressAfter != "" {
+		if d, err := ParseDuration(spec.CompressAfter, Day); err != nil || d < 0 {
+			return binSpec{}, fmt.Errorf("bin %s: invalid compress_after %q", name, spec.CompressAfter)
+		}
+	}
+	if spec.CompressMinSize != "" {
+		if size, err := ParseSize(spec.CompressMinSize, MB); err != nil || size < 0 {
+			return binSpec{}, fmt.Errorf("bin %s: invalid compress_min_size %q", name, spec.CompressMinSize)
+		}
+	}
+	if spec.KeyFile != "" && !spec.Encrypt {
+		return binSpec{}, fmt.Errorf("bin %s: key_file needs encrypt", name)
+	}
+	return spec, nil
+}
@@ -1,112 +1,130 @@
 package config
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"fmt"
+	"reflect"
+	"sort"
 )
 
-// Config represents the application configuration
+// Config represents the application configuration. Each field with a desc
+// tag is a config key; see Key for the tags that declare it.
 type Config struct {
-	TrashDir       string `json:"trash_dir"`
-	ConfirmDelete  bool   `json:"confirm_delete"`
-	AutoEmptyDays  int    `json:"auto_empty_days"`
-	MaxTrashSizeMB int    `json:"max_trash_size_mb"`
+	TrashDir          string   `json:"trash_dir" type:"path" default:"~/.local/share/Trash" validate:"nonempty" desc:"Trash directory location"`
+	ConfirmDelete     bool     `json:"confirm_delete" default:"true" desc:"Confirm before permanent deletion"`
+	AutoEmptyDays     int      `json:"auto_empty_days" type:"days" default:"30" validate:"min=0" desc:"Auto-empty trash after N days"`
+	MaxTrashSizeMB    int      `json:"max_trash_size_mb" type:"size_mb" default:"1024" validate:"min=0" desc:"Maximum trash size in MB"`
+	MinFreeSpaceMB    int      `json:"min_free_space_mb" type:"size_mb" default:"0" validate:"min=0" desc:"Purge items in eviction order while the trash's filesystem has less free space than this; 0 turns it off"`
+	Eviction          string   `json:"eviction" default:"oldest" validate:"oneof=oldest|largest" desc:"Which items size and free space limits purge first: oldest or largest"`
+	FreeSpaceFloorMB  int      `json:"free_space_floor_mb" type:"size_mb" default:"0" validate:"min=0" desc:"Refuse to copy data, as encrypted puts and compression do, onto a filesystem with less free space than this left; 0 turns it off"`
+	CompressAfterDays int      `json:"compress_after_days" type:"days" default:"0" validate:"min=0" desc:"Compress items in place once they are this old; 0 never compresses"`
+	CompressMinSizeMB int      `json:"compress_min_size_mb" type:"size_mb" default:"10" validate:"min=0" desc:"Only compress items of at least this size"`
+	Dedup             bool     `json:"dedup" default:"false" desc:"Keep identical trashed files once, shared by hardlinks"`
+	Shred             bool     `json:"shred" default:"false" desc:"Overwrite items before deleting them permanently"`
+	ShredPasses       int      `json:"shred_passes" default:"1" validate:"min=1" desc:"Times shredding overwrites each file"`
+	ShredPattern      string   `json:"shred_pattern" default:"zero" validate:"oneof=zero|random" desc:"What shredding overwrites files with: zero or random"`
+	GraceMinutes      int      `json:"grace_minutes" type:"minutes" default:"0" validate:"min=0" desc:"Hold deleted items this long so rc undo can bring them back; 0 deletes at once"`
+	BinName           string   `json:"bin" default:"default" validate:"nonempty" desc:"Bin to use when no --bin is given and no bin claims the directory"`
+	ProjectTrash      []string `json:"project_trash" type:"list" desc:"Git checkouts that keep a project trash: parent dirs or globs, * for all"`
+	GitCheck          string   `json:"git_check" default:"warn" validate:"oneof=off|warn|confirm" desc:"Before trashing uncommitted or untracked files in a git work tree: off, warn or confirm"`
+	GitSkipClean      bool     `json:"git_skip_clean" default:"false" desc:"Delete clean tracked files instead of trashing them, since git holds a copy"`
+	SudoTrash         string   `json:"sudo_trash" default:"user" validate:"oneof=user|root" desc:"Under sudo, trash into the invoking user's trash (user) or root's own (root)"`
+
+	sources map[string]source    // Layer each key came from
+	bins    map[string]binSource // Named bins, see Bin
+	rules   rulesSource          // Retention rules, see Rule
 }
 
 // DefaultConfig returns a new Config with default values
 func DefaultConfig() *Config {
-	homeDir, _ := os.UserHomeDir()
-	return &Config{
-		TrashDir:       filepath.Join(homeDir, ".local", "share", "Trash"),
-		ConfirmDelete:  true,
-		AutoEmptyDays:  30,
-		MaxTrashSizeMB: 1024,
+	cfg := &Config{}
+	for _, key := range registry {
+		cfg.setFrom(key, key.DefaultValue(), OriginDefault, false)
 	}
+	return cfg
 }
 
-// ConfigPath returns the path to the config file
-func ConfigPath() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".trashrc")
+// Get retrieves a config value by key
+func (c *Config) Get(key string) interface{} {
+	k, ok := Lookup(key)
+	if !ok {
+		return nil
+	}
+	return c.field(k).Interface()
 }
 
-// Load loads the config from ~/.trashrc or creates a default one
-func Load() (*Config, error) {
-	configPath := ConfigPath()
-
-	// If config doesn't exist, create default
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		cfg := DefaultConfig()
-		if err := cfg.Save(); err != nil {
-			return nil, err
-		}
-		return cfg, nil
+// Set sets a config value by key. It returns false if the key is unknown,
+// the value has the wrong type or it fails validation.
+func (c *Config) Set(key string, value interface{}) bool {
+	k, ok := Lookup(key)
+	if !ok || k.Check(value) != nil {
+		return false
 	}
+	c.setFrom(k, value, ConfigPath(), true)
+	return true
+}
 
-	data, err := os.ReadFile(configPath)
+// SetString parses a value as written on the command line, such as "2GB"
+// or "14d", validates it and sets the key
+func (c *Config) SetString(key, raw string) error {
+	k, ok := Lookup(key)
+	if !ok {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	value, err := k.Parse(raw)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	c.setFrom(k, value, ConfigPath(), true)
+	return nil
+}
 
-	cfg := &Config{}
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, err
+// Validate checks every value against its key's rules and returns all
+// problems found
+func (c *Config) Validate() []error {
+	var errs []error
+	for _, k := range registry {
+		if err := k.Check(c.field(k).Interface()); err != nil {
+			errs = append(errs, err)
+		}
 	}
-
-	return cfg, nil
+	return errs
 }
 
-// Save saves the config to ~/.trashrc
-func (c *Config) Save() error {
-	data, err := json.MarshalIndent(c, "", "  ")
+// ValidateFile checks a config file for syntax errors, unknown keys and
+// invalid values
+func ValidateFile(path string) []error {
+	values, err := readFile(path)
 	if err != nil {
-		return err
+		return []error{err}
 	}
 
-	configPath := ConfigPath()
-	return os.WriteFile(configPath, data, 0644)
-}
-
-// Get retrieves a config value by key
-func (c *Config) Get(key string) interface{} {
-	switch key {
-	case "trash_dir":
-		return c.TrashDir
-	case "confirm_delete":
-		return c.ConfirmDelete
-	case "auto_empty_days":
-		return c.AutoEmptyDays
-	case "max_trash_size_mb":
-		return c.MaxTrashSizeMB
-	default:
-		return nil
+	var errs []error
+	for name := range values {
+		if _, ok := Lookup(name); !ok && name != binsKey && name != rulesKey {
+			errs = append(errs, fmt.Errorf("unknown config key: %s", name))
+		}
 	}
-}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
 
-// Set sets a config value by key
-func (c *Config) Set(key string, value interface{}) bool {
-	switch key {
-	case "trash_dir":
-		if v, ok := value.(string); ok {
-			c.TrashDir = v
-			return true
-		}
-	case "confirm_delete":
-		if v, ok := value.(bool); ok {
-			c.ConfirmDelete = v
-			return true
-		}
-	case "auto_empty_days":
-		if v, ok := value.(int); ok {
-			c.AutoEmptyDays = v
-			return true
-		}
-	case "max_trash_size_mb":
-		if v, ok := value.(int); ok {
-			c.MaxTrashSizeMB = v
-			return true
+	for _, k := range registry {
+		if raw, ok := values[k.Name]; ok {
+			if _, err := k.decode(raw); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
-	return false
+	if raw, ok := values[binsKey]; ok {
+		_, binErrs := decodeBins(raw)
+		errs = append(errs, binErrs...)
+	}
+	if raw, ok := values[rulesKey]; ok {
+		_, ruleErrs := decodeRules(raw)
+		errs = append(errs, ruleErrs...)
+	}
+	return errs
+}
+
+// field returns the struct field behind a key
+func (c *Config) field(k Key) reflect.Value {
+	return reflect.ValueOf(c).Elem().FieldByIndex(k.index)
 }
@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -33,6 +36,7 @@ func TestConfigSaveLoad(t *testing.T) {
 	originalHome := os.Getenv("HOME")
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
+	t.Setenv("XDG_CONFIG_HOME", "")
 
 	// Create and save config
 	cfg := DefaultConfig()
@@ -91,3 +95,559 @@ func TestConfigGetSet(t *testing.T) {
 		t.Error("Set should fail for invalid key")
 	}
 }
+
+func TestKeysMatchGet(t *testing.T) {
+	cfg := DefaultConfig()
+	for _, key := range Keys() {
+		if cfg.Get(key) == nil {
+			t.Errorf("Key %s is listed but not supported by Get", key)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"512", 512 * MB, false},
+		{"2GB", 2 * GB, false},
+		{"2gib", 2 * GB, false},
+		{"1.5G", 3 * GB / 2, false},
+		{"100K", 100 * KB, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"GB", 0, true},
+		{"5XB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input, MB)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, expected %d", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"14d", 14 * Day, false},
+		{"2w", 14 * Day, false},
+		{"1y", 365 * Day, false},
+		{"36h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7", 7 * Day, false},
+		{"soon", 0, true},
+		{"3x", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.input, Day)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.expected {
+			t.Errorf("ParseDuration(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+
+	if s := FormatDuration(14 * Day); s != "2w" {
+		t.Errorf("FormatDuration(14d) = %q, expected 2w", s)
+	}
+}
+
+func TestSetString(t *testing.T) {
+	cfg := DefaultConfig()
+
+	tests := []struct {
+		key, value string
+		expected   interface{}
+		wantErr    bool
+	}{
+		{"max_trash_size_mb", "2GB", 2048, false},
+		{"max_trash_size_mb", "512", 512, false},
+		{"max_trash_size_mb", "-5", nil, true},
+		{"max_trash_size_mb", "1.5K", nil, true},
+		{"auto_empty_days", "2w", 14, false},
+		{"auto_empty_days", "12h", nil, true},
+		{"grace_minutes", "1d", 1440, false},
+		{"grace_minutes", "90s", nil, true},
+		{"confirm_delete", "no", false, false},
+		{"confirm_delete", "maybe", nil, true},
+		{"trash_dir", "", nil, true},
+		{"git_check", "confirm", "confirm", false},
+		{"git_check", "maybe", nil, true},
+		{"eviction", "largest", "largest", false},
+		{"eviction", "newest", nil, true},
+		{"unknown_key", "1", nil, true},
+	}
+
+	for _, tt := range tests {
+		err := cfg.SetString(tt.key, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetString(%q, %q) error = %v, wantErr %v", tt.key, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cfg.Get(tt.key) != tt.expected {
+			t.Errorf("SetString(%q, %q) stored %v, expected %v", tt.key, tt.value, cfg.Get(tt.key), tt.expected)
+		}
+	}
+
+	if cfg.Set("max_trash_size_mb", -5) {
+		t.Error("Set should reject values that fail validation")
+	}
+	if cfg.Set("auto_empty_days", "30") {
+		t.Error("Set should reject values of the wrong type")
+	}
+}
+
+func TestListKey(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.SetString("project_trash", " ~/src, *,"); err != nil {
+		t.Fatalf("Failed to set list: %v", err)
+	}
+	if got := cfg.ProjectTrash; len(got) != 2 || got[0] != "~/src" || got[1] != "*" {
+		t.Errorf("Unexpected list: %q", got)
+	}
+
+	key, _ := Lookup("project_trash")
+	if s := key.Format(cfg.ProjectTrash); s != "~/src,*" {
+		t.Errorf("Format = %q, expected ~/src,*", s)
+	}
+	if value, err := key.decode([]byte(`["~/a", "~/b"]`)); err != nil || len(value.([]string)) != 2 {
+		t.Errorf("decode of a JSON array = %v, %v", value, err)
+	}
+}
+
+func TestRegistryDefaults(t *testing.T) {
+	cfg := DefaultConfig()
+	for _, key := range Registry() {
+		if key.Description == "" {
+			t.Errorf("Key %s has no description", key.Name)
+		}
+		if err := key.Check(cfg.Get(key.Name)); err != nil {
+			t.Errorf("Default for %s is invalid: %v", key.Name, err)
+		}
+	}
+	if errs := cfg.Validate(); len(errs) != 0 {
+		t.Errorf("Default config should be valid, got %v", errs)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := `{"trash_dir": "/tmp/trash", "max_trash_size_mb": -5, "colour": true}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	errs := ValidateFile(path)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "colour") {
+		t.Errorf("Expected unknown key error first, got %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "max_trash_size_mb") {
+		t.Errorf("Expected max_trash_size_mb error, got %v", errs[1])
+	}
+}
+
+// setupLayers points every config layer at a temporary directory
+func setupLayers(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	for _, k := range Registry() {
+		t.Setenv(k.EnvVar(), "")
+		os.Unsetenv(k.EnvVar())
+	}
+
+	original := SystemConfigPath
+	SystemConfigPath = filepath.Join(dir, "etc", "config")
+	t.Cleanup(func() { SystemConfigPath = original })
+	return dir
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := setupLayers(t)
+
+	writeConfig(t, SystemConfigPath, `{"trash_dir": "/srv/trash", "auto_empty_days": 7, "max_trash_size_mb": 100}`)
+	writeConfig(t, LegacyConfigPath(), `{"auto_empty_days": 10, "confirm_delete": false}`)
+	writeConfig(t, UserConfigPath(), `{"auto_empty_days": "2w"}`)
+	t.Setenv("RC_MAX_TRASH_SIZE_MB", "1GB")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.Override("trash_dir", "~/flag-trash", "flag --trash-dir"); err != nil {
+		t.Fatalf("Failed to override: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  interface{}
+		origin string
+	}{
+		{"trash_dir", filepath.Join(dir, "flag-trash"), "flag --trash-dir"},
+		{"confirm_delete", false, LegacyConfigPath()},
+		{"auto_empty_days", 14, UserConfigPath()},
+		{"max_trash_size_mb", 1024, "env RC_MAX_TRASH_SIZE_MB"},
+	}
+	for _, tt := range tests {
+		if got := cfg.Get(tt.key); got != tt.value {
+			t.Errorf("%s = %v, expected %v", tt.key, got, tt.value)
+		}
+		if got := cfg.Origin(tt.key); got != tt.origin {
+			t.Errorf("%s origin = %q, expected %q", tt.key, got, tt.origin)
+		}
+	}
+}
+
+func TestLoadInvalidLayer(t *testing.T) {
+	setupLayers(t)
+	writeConfig(t, UserConfigPath(), `{"auto_empty_days": -1, "confirm_delete": false}`)
+
+	cfg, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "auto_empty_days") {
+		t.Fatalf("Expected an auto_empty_days error, got %v", err)
+	}
+	if cfg.AutoEmptyDays != 30 || cfg.ConfirmDelete {
+		t.Errorf("Valid values should still apply: %+v", cfg)
+	}
+}
+
+func TestSaveKeepsLowerLayers(t *testing.T) {
+	setupLayers(t)
+	writeConfig(t, SystemConfigPath, `{"max_trash_size_mb": 100}`)
+	t.Setenv("RC_TRASH_DIR", "/tmp/env-trash")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.SetString("auto_empty_days", "7"); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	data, err := os.ReadFile(UserConfigPath())
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	saved := string(data)
+	if !strings.Contains(saved, `"auto_empty_days": 7`) {
+		t.Errorf("Saved config is missing the new value:\n%s", saved)
+	}
+	for _, key := range []string{"trash_dir", "max_trash_size_mb", "confirm_delete"} {
+		if strings.Contains(saved, key) {
+			t.Errorf("Saved config should not contain %s:\n%s", key, saved)
+		}
+	}
+}
+
+func TestLoadHasNoSideEffects(t *testing.T) {
+	dir := setupLayers(t)
+
+	if _, err := Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Load should not create files, found %d", len(entries))
+	}
+}
+
+func TestSaveIsAtomicAndPrivate(t *testing.T) {
+	setupLayers(t)
+
+	cfg := DefaultConfig()
+	cfg.ConfirmDelete = false
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	info, err := os.Stat(UserConfigPath())
+	if err != nil {
+		t.Fatalf("Failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Config should be 0600, got %v", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(UserConfigPath()))
+	if len(entries) != 1 {
+		t.Errorf("Save should leave no temporary files, found %d entries", len(entries))
+	}
+
+	data, _ := os.ReadFile(UserConfigPath())
+	if !strings.Contains(string(data), `"version": 2`) {
+		t.Errorf("Saved config should carry the schema version:\n%s", data)
+	}
+}
+
+func TestMigrateVersion1(t *testing.T) {
+	dir := setupLayers(t)
+
+	// rc 1.0 wrote every key, defaults included, on first run
+	writeConfig(t, SystemConfigPath, `{"max_trash_size_mb": 100}`)
+	writeConfig(t, LegacyConfigPath(), `{
+  "trash_dir": "`+filepath.Join(dir, ".local/share/Trash")+`",
+  "confirm_delete": true,
+  "auto_empty_days": 45,
+  "max_trash_size_mb": 1024
+}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.AutoEmptyDays != 45 || cfg.Origin("auto_empty_days") != LegacyConfigPath() {
+		t.Errorf("User value should survive migration, got %d from %s", cfg.AutoEmptyDays, cfg.Origin("auto_empty_days"))
+	}
+	if cfg.MaxTrashSizeMB != 100 {
+		t.Errorf("Default written by version 1 should not hide the system config, got %d", cfg.MaxTrashSizeMB)
+	}
+
+	writeConfig(t, UserConfigPath(), `{"version": 99}`)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected an error for a newer schema, got %v", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	setupLayers(t)
+	writeConfig(t, UserConfigPath(), `{"version": 2, "auto_empty_days": 5}`)
+
+	backups, err := Reset()
+	if err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if len(backups) != 1 || backups[0] != UserConfigPath()+".bak" {
+		t.Fatalf("Expected one backup of the user config, got %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); !strings.Contains(string(data), `"auto_empty_days": 5`) {
+		t.Errorf("Backup should hold the previous config, got %s", data)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.AutoEmptyDays != 30 {
+		t.Errorf("AutoEmptyDays should be back to 30, got %d", cfg.AutoEmptyDays)
+	}
+}
+
+func TestBins(t *testing.T) {
+	dir := setupLayers(t)
+	writeConfig(t, SystemConfigPath, `{"bins": {"media": {"dir": "/srv/media-trash", "max_size": "50GB"}}}`)
+	writeConfig(t, UserConfigPath(), `{
+  "auto_empty_days": 14,
+  "shred": true,
+  "bins": {
+    "scratch": {"dir": "~/.cache/scratch", "retention": "2d", "paths": ["~/tmp/"], "compress_after": "1d", "shred": false},
+    "work": {"dir": "~/work-trash", "paths": ["~/work"], "encrypt": true, "key_file": "~/.rc.key"}
+  }
+}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	var names []string
+	for _, bin := range cfg.Bins() {
+		names = append(names, bin.Name)
+	}
+	if strings.Join(names, ",") != "default,media,scratch,work" {
+		t.Errorf("Unexpected bins: %v", names)
+	}
+
+	scratch, ok := cfg.LookupBin("scratch")
+	if !ok || scratch.Dir != filepath.Join(dir, ".cache/scratch") || scratch.Retention != 2*Day || scratch.MaxSize != 1024*MB {
+		t.Errorf("Unexpected scratch bin: %+v", scratch)
+	}
+	if work, _ := cfg.LookupBin("work"); work.Retention != 14*Day {
+		t.Errorf("Bins without retention should use auto_empty_days, got %v", work.Retention)
+	}
+	if scratch.CompressAfter != Day || scratch.CompressMinSize != 10*MB {
+		t.Errorf("Unexpected scratch compression: %v, %d", scratch.CompressAfter, scratch.CompressMinSize)
+	}
+	if work, _ := cfg.LookupBin("work"); !work.Encrypt || work.KeyFile != filepath.Join(dir, ".rc.key") || scratch.Encrypt {
+		t.Errorf("Unexpected encryption: work %+v, scratch %+v", work, scratch)
+	}
+	if work, _ := cfg.LookupBin("work"); !work.Shred || work.ShredPasses != 1 || scratch.Shred {
+		t.Errorf("Unexpected shredding: work %+v, scratch %+v", work, scratch)
+	}
+
+	tests := []struct {
+		dir      string
+		flag     string
+		expected string
+	}{
+		{filepath.Join(dir, "tmp", "x"), "", "scratch"},
+		{filepath.Join(dir, "work"), "", "work"},
+		{filepath.Join(dir, "tmpfoo"), "", "default"},
+		{filepath.Join(dir, "work"), "media", "media"},
+	}
+	for _, tt := range tests {
+		cfg, _ := Load()
+		if tt.flag != "" {
+			cfg.Override("bin", tt.flag, "flag --bin")
+		}
+		bin, err := cfg.ActiveBin(tt.dir)
+		if err != nil || bin.Name != tt.expected {
+			t.Errorf("ActiveBin(%s) with --bin %q = %s, %v; expected %s", tt.dir, tt.flag, bin.Name, err, tt.expected)
+		}
+	}
+
+	cfg.Override("bin", "nope", "flag --bin")
+	if _, err := cfg.ActiveBin(dir); err == nil {
+		t.Error("ActiveBin should fail for an unknown bin")
+	}
+
+	// Saving keeps the user's bins but not the system's
+	cfg.SetString("confirm_delete", "false")
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	data, _ := os.ReadFile(UserConfigPath())
+	if !strings.Contains(string(data), `"scratch"`) || strings.Contains(string(data), `"media"`) {
+		t.Errorf("Unexpected bins in saved config:\n%s", data)
+	}
+}
+
+func TestInvalidBins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeConfig(t, path, `{"bins": {
+  "default": {"dir": "/x"},
+  "bad name": {"dir": "/x"},
+  "nodir": {},
+  "typo": {"dir": "/x", "retension": "3d"},
+  "neg": {"dir": "/x", "max_size": "-5"},
+  "key": {"dir": "/x", "key_file": "~/.rc.key"},
+  "ok": {"dir": "/x", "retention": "1w"}
+}}`)
+
+	if errs := ValidateFile(path); len(errs) != 6 {
+		t.Errorf("Expected 6 problems, got %d: %v", len(errs), errs)
+	}
+}
+
+func TestRules(t *testing.T) {
+	dir := setupLayers(t)
+	writeConfig(t, SystemConfigPath, `{"rules": [{"match": "**", "retention": "1d"}]}`)
+	writeConfig(t, UserConfigPath(), `{"rules": [
+  {"match": "*.iso", "delete": true},
+  {"match": "**/*.log", "retention": "1d"},
+  {"match": "~/Downloads/**", "retention": "7d", "max_size": "1GB", "delete": true},
+  {"match": "~/Documents/**", "retention": "180d", "compress": true, "bin": "vault"},
+  {"match": "/var/tmp/*", "retention": "2d"}
+]}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	// The user's rules replace the system's as a whole
+	if rules := cfg.Rules(); len(rules) != 5 || rules[0].Origin != UserConfigPath() {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/srv/images/debian.iso", "*.iso"},
+		{filepath.Join(dir, "Downloads", "debian.iso"), "*.iso"},
+		{filepath.Join(dir, "Downloads", "build.log"), "**/*.log"},
+		{"/build.log", "**/*.log"},
+		{filepath.Join(dir, "Downloads", "a", "b", "c.zip"), "~/Downloads/**"},
+		{filepath.Join(dir, "Downloads"), "~/Downloads/**"},
+		{filepath.Join(dir, "Documents", "report.pdf"), "~/Documents/**"},
+		{"/var/tmp/x", "/var/tmp/*"},
+		{"/var/tmp/x/y", ""},
+		{filepath.Join(dir, "Downloadsx", "a"), ""},
+		{filepath.Join(dir, "notes.txt"), ""},
+	}
+	for _, tt := range tests {
+		rule, ok := cfg.RuleFor(tt.path)
+		if ok != (tt.expected != "") || rule.Match != tt.expected {
+			t.Errorf("RuleFor(%s) = %q, %v; expected %q", tt.path, rule.Match, ok, tt.expected)
+		}
+	}
+
+	rule, _ := cfg.RuleFor(filepath.Join(dir, "Documents", "report.pdf"))
+	if rule.Retention != 180*Day || !rule.Compress || rule.Bin != "vault" || rule.Delete {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+	if rule, _ := cfg.RuleFor(filepath.Join(dir, "Downloads", "x")); rule.MaxSize != 1024*MB {
+		t.Errorf("Unexpected max_size: %d", rule.MaxSize)
+	}
+
+	// Saving keeps the user's rules in order
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	saved, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load saved config: %v", err)
+	}
+	if rules := saved.Rules(); len(rules) != 5 || rules[1].Match != "**/*.log" {
+		t.Errorf("Unexpected rules after saving: %+v", rules)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeConfig(t, path, `{"rules": [
+  {"match": ""},
+  {"match": "[a-", "retention": "1d"},
+  {"match": "*.tmp", "retension": "1d"},
+  {"match": "*.tmp", "retention": "0"},
+  {"match": "*.tmp", "max_size": "-1", "delete": true},
+  {"match": "*.tmp", "max_size": "1GB"},
+  {"match": "*.iso", "delete": true, "bin": "vault"},
+  {"match": "*.iso", "delete": true, "max_size": "1GB", "bin": "vault"},
+  {"match": "*.tmp", "bin": "bad name"},
+  {"match": "*.iso", "delete": true}
+]}`)
+
+	if errs := ValidateFile(path); len(errs) != 8 {
+		t.Errorf("Expected 8 problems, got %d: %v", len(errs), errs)
+	}
+
+	writeConfig(t, path, `{"rules": {"match": "*.iso"}}`)
+	if errs := ValidateFile(path); len(errs) != 1 {
+		t.Errorf("Expected rules that are not an array to be rejected, got %v", errs)
+	}
+}
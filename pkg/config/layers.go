@@ -0,0 +1,328 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// SystemConfigPath is the machine-wide config file, read before the user's
+var SystemConfigPath = "/etc/gocycled/config"
+
+// OriginDefault is the origin of values that no layer overrides
+const OriginDefault = "default"
+
+// source records which layer set a key, and to what
+type source struct {
+	origin string
+	value  interface{}
+	user   bool // Whether the value belongs in the user config file
+}
+
+// UserConfigPath returns $XDG_CONFIG_HOME/gocycled/config, falling back to
+// ~/.config when XDG_CONFIG_HOME is unset. It returns "" if neither that
+// nor the home directory is known.
+func UserConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(dir, "gocycled", "config")
+}
+
+// LegacyConfigPath returns ~/.trashrc, which is still read for
+// compatibility, or "" if the home directory is unknown
+func LegacyConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".trashrc")
+}
+
+// ConfigPath returns the user config file that Save writes: the XDG file,
+// unless only ~/.trashrc exists
+func ConfigPath() string {
+	userPath := UserConfigPath()
+	if _, err := os.Stat(userPath); err != nil {
+		if _, err := os.Stat(LegacyConfigPath()); err == nil {
+			return LegacyConfigPath()
+		}
+	}
+	return userPath
+}
+
+// Files returns the config files in the order they are applied. Later files
+// override earlier ones.
+func Files() []string {
+	var files []string
+	for _, path := range []string{SystemConfigPath, LegacyConfigPath(), UserConfigPath()} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// Load resolves the config from built-in defaults, the config files and
+// RC_* environment variables, in that order. Missing files are skipped.
+// If a file or variable holds an invalid value, Load returns the config
+// without it together with an error describing every problem.
+func Load() (*Config, error) {
+	cfg := DefaultConfig()
+
+	var errs []error
+	for _, path := range Files() {
+		errs = append(errs, cfg.applyFile(path, path != SystemConfigPath)...)
+	}
+	errs = append(errs, cfg.applyEnv()...)
+
+	return cfg, errors.Join(errs...)
+}
+
+// Save writes the values that belong to the user to ConfigPath. Values that
+// only come from defaults, the system file, the environment or flags are
+// left out, so those layers keep applying. The file is replaced atomically
+// and is only readable by its owner.
+func (c *Config) Save() error {
+	configPath := ConfigPath()
+	if configPath == "" {
+		return errors.New("cannot locate the user config file: home directory unknown")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\n  %q: %d", versionKey, SchemaVersion)
+	for _, k := range registry {
+		value := c.field(k).Interface()
+		if src, ok := c.sources[k.Name]; ok && !src.user && reflect.DeepEqual(value, src.value) {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, ",\n  %q: %s", k.Name, data)
+	}
+	if bins := c.userBins(); len(bins) > 0 {
+		data, err := json.MarshalIndent(bins, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, ",\n  %q: %s", binsKey, data)
+	}
+	if rules := c.userRules(); len(rules) > 0 {
+		data, err := json.MarshalIndent(rules, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, ",\n  %q: %s", rulesKey, data)
+	}
+	buf.WriteString("\n}\n")
+
+	return writeFileAtomic(configPath, buf.Bytes(), 0600)
+}
+
+// Reset moves the user config files aside, keeping each as a ".bak" file
+// next to it, and writes an empty user config so that defaults and the
+// system config apply again. It returns the backups it made.
+func Reset() ([]string, error) {
+	var backups []string
+	for _, path := range []string{LegacyConfigPath(), UserConfigPath()} {
+		if _, err := os.Stat(path); path == "" || err != nil {
+			continue
+		}
+		backup := path + ".bak"
+		if err := os.Rename(path, backup); err != nil {
+			return backups, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, DefaultConfig().Save()
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it
+// and renames it over path, so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Origin describes where the current value of a key came from: "default",
+// a config file path, "env RC_..." or "flag --..."
+func (c *Config) Origin(key string) string {
+	if src, ok := c.sources[key]; ok {
+		if reflect.DeepEqual(c.Get(key), src.value) {
+			return src.origin
+		}
+	}
+	return "set"
+}
+
+// Override sets a key from a command-line flag. Overrides are the highest
+// layer and are never saved.
+func (c *Config) Override(key, raw, origin string) error {
+	k, ok := Lookup(key)
+	if !ok {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	value, err := k.Parse(raw)
+	if err != nil {
+		return err
+	}
+	c.setFrom(k, value, origin, false)
+	return nil
+}
+
+// EnvVar returns the environment variable that overrides the key
+func (k Key) EnvVar() string {
+	return "RC_" + strings.ToUpper(k.Name)
+}
+
+// Flag returns the command-line flag that overrides the key
+func (k Key) Flag() string {
+	return "--" + strings.ReplaceAll(k.Name, "_", "-")
+}
+
+// setFrom sets a key and records the layer it came from
+func (c *Config) setFrom(k Key, value interface{}, origin string, user bool) {
+	c.field(k).Set(reflect.ValueOf(value))
+	if c.sources == nil {
+		c.sources = make(map[string]source)
+	}
+	c.sources[k.Name] = source{origin: origin, value: value, user: user}
+}
+
+// applyFile applies the keys set in a config file. Unknown keys are
+// ignored here and reported by ValidateFile.
+func (c *Config) applyFile(path string, user bool) []error {
+	values, err := readFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", path, err)}
+	}
+
+	var errs []error
+	for _, k := range registry {
+		raw, ok := values[k.Name]
+		if !ok {
+			continue
+		}
+		value, err := k.decode(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		c.setFrom(k, value, path, user)
+	}
+	if raw, ok := values[binsKey]; ok {
+		for _, err := range c.applyBins(raw, path, user) {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	if raw, ok := values[rulesKey]; ok {
+		for _, err := range c.applyRules(raw, path, user) {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errs
+}
+
+// applyEnv applies RC_* environment variables
+func (c *Config) applyEnv() []error {
+	var errs []error
+	for _, k := range registry {
+		raw, ok := os.LookupEnv(k.EnvVar())
+		if !ok {
+			continue
+		}
+		value, err := k.Parse(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k.EnvVar(), err))
+			continue
+		}
+		c.setFrom(k, value, "env "+k.EnvVar(), false)
+	}
+	return errs
+}
+
+// readFile reads a config file into its raw key/value pairs, migrated to
+// the current schema
+func readFile(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := migrate(values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// decode converts a value from a config file. Strings go through the same
+// parser as "rc config set", so files may say "2GB" or "~/trash".
+func (k Key) decode(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return k.Parse(s)
+	}
+
+	ptr := reflect.New(reflect.TypeOf(k.DefaultValue()))
+	if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("%s: expected %s, got %s", k.Name, k.Syntax(), raw)
+	}
+	value := ptr.Elem().Interface()
+	if err := k.Check(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
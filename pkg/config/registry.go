@@ -0,0 +1,283 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key describes a config key. Keys are declared by struct tags on Config
+// fields:
+//
+//	json:"name"       the key name, as used in the file and on the CLI
+//	type:"..."        value type: string, path, bool, int, days, minutes,
+//	                  size_mb or list (defaults to the Go field type)
+//	default:"..."     default value, in the same syntax as "rc config set"
+//	validate:"..."    comma-separated rules: nonempty, min=N, max=N,
+//	                  oneof=a|b|c
+//	desc:"..."        one-line description for help and completion
+type Key struct {
+	Name        string
+	Type        string
+	Default     string
+	Description string
+	Validate    string
+
+	index []int
+}
+
+// keyType parses and formats the values of one key type
+type keyType struct {
+	kind   reflect.Kind
+	syntax string // Shown in help text
+	parse  func(raw string) (interface{}, error)
+	format func(value interface{}) string
+}
+
+var keyTypes = map[string]keyType{
+	"string": {
+		kind:   reflect.String,
+		syntax: "text",
+		parse:  func(raw string) (interface{}, error) { return raw, nil },
+	},
+	"path": {
+		kind:   reflect.String,
+		syntax: "path",
+		parse:  func(raw string) (interface{}, error) { return ExpandPath(raw), nil },
+	},
+	"bool": {
+		kind:   reflect.Bool,
+		syntax: "true/false",
+		parse:  parseBool,
+	},
+	"int": {
+		kind:   reflect.Int,
+		syntax: "integer",
+		parse: func(raw string) (interface{}, error) {
+			v, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				return nil, fmt.Errorf("invalid integer: %q", raw)
+			}
+			return v, nil
+		},
+	},
+	"days": {
+		kind:   reflect.Int,
+		syntax: "days, e.g. 30 or 14d or 2w",
+		parse: func(raw string) (interface{}, error) {
+			d, err := ParseDuration(raw, Day)
+			if err != nil {
+				return nil, err
+			}
+			if d%Day != 0 {
+				return nil, fmt.Errorf("%q is not a whole number of days", raw)
+			}
+			return int(d / Day), nil
+		},
+		format: func(value interface{}) string { return fmt.Sprintf("%dd", value) },
+	},
+	"minutes": {
+		kind:   reflect.Int,
+		syntax: "minutes, e.g. 10 or 2h or 1d",
+		parse: func(raw string) (interface{}, error) {
+			d, err := ParseDuration(raw, time.Minute)
+			if err != nil {
+				return nil, err
+			}
+			if d%time.Minute != 0 {
+				return nil, fmt.Errorf("%q is not a whole number of minutes", raw)
+			}
+			return int(d / time.Minute), nil
+		},
+		format: func(value interface{}) string {
+			if value.(int) == 0 {
+				return "0m"
+			}
+			return FormatDuration(time.Duration(value.(int)) * time.Minute)
+		},
+	},
+	"list": {
+		kind:   reflect.Slice,
+		syntax: "comma-separated list",
+		parse: func(raw string) (interface{}, error) {
+			var list []string
+			for _, v := range strings.Split(raw, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					list = append(list, v)
+				}
+			}
+			return list, nil
+		},
+		format: func(value interface{}) string { return strings.Join(value.([]string), ",") },
+	},
+	"size_mb": {
+		kind:   reflect.Int,
+		syntax: "size, e.g. 1024 (MB) or 2GB",
+		parse: func(raw string) (interface{}, error) {
+			size, err := ParseSize(raw, MB)
+			if err != nil {
+				return nil, err
+			}
+			if size%MB != 0 {
+				return nil, fmt.Errorf("%q is not a whole number of megabytes", raw)
+			}
+			return int(size / MB), nil
+		},
+		format: func(value interface{}) string { return fmt.Sprintf("%dMB", value) },
+	},
+}
+
+// registry holds every key declared on Config, in field order
+var registry = buildRegistry(reflect.TypeOf(Config{}))
+
+// buildRegistry reads the key declarations from the struct tags of t
+func buildRegistry(t reflect.Type) []Key {
+	var keys []Key
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || field.Tag.Get("desc") == "" {
+			continue
+		}
+
+		key := Key{
+			Name:        name,
+			Type:        field.Tag.Get("type"),
+			Default:     field.Tag.Get("default"),
+			Description: field.Tag.Get("desc"),
+			Validate:    field.Tag.Get("validate"),
+			index:       field.Index,
+		}
+		if key.Type == "" {
+			key.Type = field.Type.Kind().String()
+		}
+
+		kt, ok := keyTypes[key.Type]
+		if !ok || kt.kind != field.Type.Kind() {
+			panic(fmt.Sprintf("config: field %s has unsupported type %q", field.Name, key.Type))
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Registry returns every config key in display order
+func Registry() []Key {
+	return append([]Key(nil), registry...)
+}
+
+// Keys returns the config keys accepted by Get and Set, in display order
+func Keys() []string {
+	names := make([]string, len(registry))
+	for i, key := range registry {
+		names[i] = key.Name
+	}
+	return names
+}
+
+// Lookup returns the key with the given name
+func Lookup(name string) (Key, bool) {
+	for _, key := range registry {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Syntax describes the values the key accepts
+func (k Key) Syntax() string {
+	return keyTypes[k.Type].syntax
+}
+
+// Parse converts a value written on the command line or in the environment
+// to the key's type and validates it
+func (k Key) Parse(raw string) (interface{}, error) {
+	value, err := keyTypes[k.Type].parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", k.Name, err)
+	}
+	if err := k.Check(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Format renders a value of this key for display, using the key's unit
+func (k Key) Format(value interface{}) string {
+	if format := keyTypes[k.Type].format; format != nil {
+		return format(value)
+	}
+	return fmt.Sprint(value)
+}
+
+// Check applies the key's validation rules to a value of its type
+func (k Key) Check(value interface{}) error {
+	if reflect.TypeOf(value) == nil || reflect.TypeOf(value).Kind() != keyTypes[k.Type].kind {
+		return fmt.Errorf("%s: expected %s, got %T", k.Name, k.Syntax(), value)
+	}
+
+	for _, rule := range strings.Split(k.Validate, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "":
+		case "nonempty":
+			if s, _ := value.(string); strings.TrimSpace(s) == "" {
+				return fmt.Errorf("%s must not be empty", k.Name)
+			}
+		case "oneof":
+			if s, _ := value.(string); !slices.Contains(strings.Split(arg, "|"), s) {
+				return fmt.Errorf("%s must be one of %s, got %q", k.Name, strings.ReplaceAll(arg, "|", ", "), s)
+			}
+		case "min", "max":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("config: invalid %s rule on %s", name, k.Name))
+			}
+			v, _ := value.(int)
+			if name == "min" && v < limit {
+				return fmt.Errorf("%s must be at least %d, got %d", k.Name, limit, v)
+			}
+			if name == "max" && v > limit {
+				return fmt.Errorf("%s must be at most %d, got %d", k.Name, limit, v)
+			}
+		default:
+			panic(fmt.Sprintf("config: unknown validation rule %q on %s", name, k.Name))
+		}
+	}
+	return nil
+}
+
+// DefaultValue returns the parsed default of the key
+func (k Key) DefaultValue() interface{} {
+	value, err := keyTypes[k.Type].parse(k.Default)
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid default for %s: %v", k.Name, err))
+	}
+	return value
+}
+
+func parseBool(raw string) (interface{}, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return nil, fmt.Errorf("invalid boolean: %q (use true or false)", raw)
+}
+
+// ExpandPath replaces a leading "~" with the home directory
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[1:])
+		}
+	}
+	return path
+}
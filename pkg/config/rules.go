@@ -0,0 +1,192 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rulesKey holds the retention rules in config files
+const rulesKey = "rules"
+
+// Rule sets how rc put trashes the files whose original path matches a glob
+type Rule struct {
+	Match     string        // The glob as written in the config file
+	Retention time.Duration // Matching items are purged after this; 0 leaves it to the bin
+	MaxSize   int64         // With Delete, only larger files are deleted; 0 means every file
+	Compress  bool          // Matching items are compressed as soon as they are trashed
+	Bin       string        // Matching files go to this bin, such as an encrypted one
+	Delete    bool          // Matching files are deleted instead of trashed, see MaxSize
+	Origin    string        // Config file that declared the rule
+}
+
+// ruleSpec is a rule as written in a config file. Rules are checked in
+// order and the first match applies:
+//
+//	"rules": [
+//	  {"match": "*.iso", "delete": true},
+//	  {"match": "**/*.log", "retention": "1d"},
+//	  {"match": "~/Downloads/**", "retention": "7d", "max_size": "4GB", "delete": true},
+//	  {"match": "~/Documents/**", "retention": "180d", "compress": true}
+//	]
+type ruleSpec struct {
+	Match     string `json:"match"`
+	Retention string `json:"retention,omitempty"`
+	MaxSize   string `json:"max_size,omitempty"`
+	Compress  bool   `json:"compress,omitempty"`
+	Bin       string `json:"bin,omitempty"`
+	Delete    bool   `json:"delete,omitempty"`
+}
+
+// rulesSource records which file declared the rules
+type rulesSource struct {
+	specs  []ruleSpec
+	origin string
+	user   bool
+}
+
+// Rules returns the retention rules in the order they are checked
+func (c *Config) Rules() []Rule {
+	rules := make([]Rule, 0, len(c.rules.specs))
+	for _, spec := range c.rules.specs {
+		rules = append(rules, resolveRule(spec, c.rules.origin))
+	}
+	return rules
+}
+
+// RuleFor returns the first rule matching an absolute path
+func (c *Config) RuleFor(path string) (Rule, bool) {
+	for _, rule := range c.Rules() {
+		if rule.Matches(path) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Matches reports whether the rule's glob matches an absolute path. Globs
+// use filepath.Match syntax for each path element, "**" stands for any
+// number of elements and a leading "~" for the home directory. Globs that
+// are not absolute match at any depth, so "*.iso" matches every ISO image.
+func (r Rule) Matches(path string) bool {
+	pattern := ExpandPath(r.Match)
+	if !filepath.IsAbs(pattern) {
+		pattern = "/**/" + pattern
+	}
+	return matchParts(strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/"), strings.Split(filepath.ToSlash(filepath.Clean(path)), "/"))
+}
+
+// matchParts matches path elements against glob elements
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// resolveRule turns a validated spec into a Rule
+func resolveRule(spec ruleSpec, origin string) Rule {
+	rule := Rule{Match: spec.Match, Compress: spec.Compress, Bin: spec.Bin, Delete: spec.Delete, Origin: origin}
+	if spec.Retention != "" {
+		rule.Retention, _ = ParseDuration(spec.Retention, Day)
+	}
+	if spec.MaxSize != "" {
+		rule.MaxSize, _ = ParseSize(spec.MaxSize, MB)
+	}
+	return rule
+}
+
+// applyRules records the valid rules declared in a config file. Rules
+// declared in a later file replace the earlier ones as a whole, since their
+// order matters.
+func (c *Config) applyRules(raw json.RawMessage, origin string, user bool) []error {
+	specs, errs := decodeRules(raw)
+	if specs != nil || len(errs) == 0 {
+		c.rules = rulesSource{specs: specs, origin: origin, user: user}
+	}
+	return errs
+}
+
+// userRules returns the rules that belong in the user config file
+func (c *Config) userRules() []ruleSpec {
+	if !c.rules.user {
+		return nil
+	}
+	return c.rules.specs
+}
+
+// decodeRules parses and validates the "rules" array of a config file. It
+// returns the valid rules and an error for each invalid one.
+func decodeRules(raw json.RawMessage) ([]ruleSpec, []error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, []error{fmt.Errorf("%s: expected an array of rules", rulesKey)}
+	}
+
+	var specs []ruleSpec
+	var errs []error
+	for i, entry := range entries {
+		spec, err := decodeRule(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %v", i+1, err))
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs, errs
+}
+
+func decodeRule(raw json.RawMessage) (ruleSpec, error) {
+	var spec ruleSpec
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return ruleSpec{}, err
+	}
+
+	if strings.TrimSpace(spec.Match) == "" {
+		return ruleSpec{}, fmt.Errorf("match must not be empty")
+	}
+	if _, err := filepath.Match(spec.Match, ""); err != nil {
+		return ruleSpec{}, fmt.Errorf("invalid match %q", spec.Match)
+	}
+	if spec.Retention != "" {
+		if d, err := ParseDuration(spec.Retention, Day); err != nil || d <= 0 {
+			return ruleSpec{}, fmt.Errorf("invalid retention %q", spec.Retention)
+		}
+	}
+	if spec.MaxSize != "" {
+		if size, err := ParseSize(spec.MaxSize, MB); err != nil || size <= 0 {
+			return ruleSpec{}, fmt.Errorf("invalid max_size %q", spec.MaxSize)
+		}
+	}
+	if spec.Bin != "" && !binNamePattern.MatchString(spec.Bin) {
+		return ruleSpec{}, fmt.Errorf("invalid bin name: %q", spec.Bin)
+	}
+	// Deleting every matching file leaves nothing for the other settings,
+	// and max_size only says which files to delete
+	if spec.MaxSize != "" && !spec.Delete {
+		return ruleSpec{}, fmt.Errorf("max_size needs delete")
+	}
+	if spec.Delete && spec.MaxSize == "" && (spec.Retention != "" || spec.Compress || spec.Bin != "") {
+		return ruleSpec{}, fmt.Errorf("delete without max_size cannot be combined with other settings")
+	}
+	return spec, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// SchemaVersion is the version of the config file format written by Save.
+// Files without a "version" key are version 1.
+const SchemaVersion = 2
+
+// versionKey holds the schema version in config files
+const versionKey = "version"
+
+// migrations[i] upgrades a file from version i+1 to version i+2
+var migrations = []func(values map[string]json.RawMessage) error{
+	migrateDefaults,
+}
+
+// migrate upgrades the raw values of a config file to SchemaVersion in
+// place and removes the version key
+func migrate(values map[string]json.RawMessage) error {
+	version := 1
+	if raw, ok := values[versionKey]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+			return fmt.Errorf("invalid %s: %s", versionKey, raw)
+		}
+		delete(values, versionKey)
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("config version %d is newer than this rc supports (%d)", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		if err := migrations[version-1](values); err != nil {
+			return fmt.Errorf("migrating from version %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// migrateDefaults drops values equal to the built-in defaults. Version 1
+// files were written in full by the first run of rc, so those values are
+// not choices the user made, and keeping them would hide the system config.
+func migrateDefaults(values map[string]json.RawMessage) error {
+	for _, k := range registry {
+		raw, ok := values[k.Name]
+		if !ok {
+			continue
+		}
+		if value, err := k.decode(raw); err == nil && reflect.DeepEqual(value, k.DefaultValue()) {
+			delete(values, k.Name)
+		}
+	}
+	return nil
+}
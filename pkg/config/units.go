@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Byte sizes use binary multiples, matching how rc displays sizes
+const (
+	KB int64 = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+)
+
+// Day is the length of a day as used by durations such as "14d"
+const Day = 24 * time.Hour
+
+// ParseSize parses a size such as "512", "100K", "2GB", "1.5GiB" or "3T"
+// into bytes. Units are case-insensitive, binary (1K = 1024) and may be
+// followed by "B" or "iB". A number without a unit is multiplied by
+// defaultUnit.
+func ParseSize(s string, defaultUnit int64) (int64, error) {
+	num, unit := splitNumber(s)
+	if num == "" {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	multiplier := defaultUnit
+	switch strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(unit), "B"), "I") {
+	case "":
+		if strings.EqualFold(unit, "B") {
+			multiplier = 1
+		}
+	case "K":
+		multiplier = KB
+	case "M":
+		multiplier = MB
+	case "G":
+		multiplier = GB
+	case "T":
+		multiplier = TB
+	default:
+		return 0, fmt.Errorf("invalid size unit in %q (use B, K, M, G or T)", s)
+	}
+
+	bytes := value * float64(multiplier)
+	if bytes > math.MaxInt64 || bytes < math.MinInt64 {
+		return 0, fmt.Errorf("size out of range: %q", s)
+	}
+	return int64(math.Round(bytes)), nil
+}
+
+// ParseDuration parses a duration such as "14d", "2w", "1y", "36h" or
+// "90m". It accepts everything time.ParseDuration does plus d (days), w
+// (weeks) and y (365 days). A number without a unit is multiplied by
+// defaultUnit.
+func ParseDuration(s string, defaultUnit time.Duration) (time.Duration, error) {
+	num, unit := splitNumber(s)
+	if num == "" {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+
+	var multiplier time.Duration
+	switch unit {
+	case "":
+		multiplier = defaultUnit
+	case "d":
+		multiplier = Day
+	case "w":
+		multiplier = 7 * Day
+	case "y":
+		multiplier = 365 * Day
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %q (use e.g. 30m, 12h, 14d, 2w)", s)
+		}
+		return d, nil
+	}
+
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	d := value * float64(multiplier)
+	if d > math.MaxInt64 || d < math.MinInt64 {
+		return 0, fmt.Errorf("duration out of range: %q", s)
+	}
+	return time.Duration(d), nil
+}
+
+// FormatDuration formats d using the largest whole unit of y, w, d, h, m or
+// s, falling back to time.Duration's format for anything finer
+func FormatDuration(d time.Duration) string {
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"y", 365 * Day},
+		{"w", 7 * Day},
+		{"d", Day},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for _, u := range units {
+		if d != 0 && d%u.size == 0 {
+			return fmt.Sprintf("%d%s", d/u.size, u.suffix)
+		}
+	}
+	return d.String()
+}
+
+// splitNumber splits "12.5GB" into "12.5" and "GB", ignoring surrounding
+// whitespace
+func splitNumber(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.' && r != '-' && r != '+'
+	})
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
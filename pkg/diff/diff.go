@@ -0,0 +1,319 @@
+// Package diff compares text files and directory trees. Line differences
+// are computed with Myers' O(ND) algorithm and written in unified format.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Op is the kind of an edit
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is a single line of an edit script
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// SplitLines splits text into lines, keeping the trailing newline on each
+// line so that a missing final newline shows up as a difference
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// IsBinary reports whether data looks like binary content: it contains a
+// NUL byte or is not valid UTF-8
+func IsBinary(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+		// Don't count a rune cut off by the sample as invalid
+		for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	return bytes.IndexByte(sample, 0) >= 0 || !utf8.Valid(sample)
+}
+
+// Lines returns the shortest edit script that turns a into b. It uses the
+// linear-space variant of Myers' algorithm, which splits the problem at
+// the middle of an optimal path instead of keeping every step for
+// backtracking, so memory stays proportional to len(a)+len(b).
+func Lines(a, b []string) []Edit {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{a: a, b: b, vf: make([]int, size), vb: make([]int, size), off: size / 2}
+	d.compare(0, len(a), 0, len(b))
+	return d.edits
+}
+
+// differ holds the inputs, the furthest reaching forward and backward
+// paths by diagonal, and the edit script built so far
+type differ struct {
+	a, b   []string
+	vf, vb []int
+	off    int // Index of diagonal 0 in vf and vb
+	edits  []Edit
+}
+
+// compare appends the edits that turn a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// Common lines at either end are not part of any edit
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, Edit{Equal, d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for _, line := range d.b[bLo:bHi] {
+			d.edits = append(d.edits, Edit{Insert, line})
+		}
+	case bLo == bHi:
+		for _, line := range d.a[aLo:aHi] {
+			d.edits = append(d.edits, Edit{Delete, line})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for _, line := range d.a[x:u] {
+			d.edits = append(d.edits, Edit{Equal, line})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for _, line := range d.a[aHi : aHi+suffix] {
+		d.edits = append(d.edits, Edit{Equal, line})
+	}
+}
+
+// middleSnake finds the middle snake of an optimal path from (aLo, bLo) to
+// (aHi, bHi) by searching from both ends at once, and returns where it
+// starts and ends. vf holds the furthest x reached forward on each
+// diagonal k = x-y, vb the furthest distance reached back from the end.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	vf, vb, off := d.vf, d.vb, d.off
+	vf[off+1], vb[off+1] = 0, 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			var px int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				px = vf[off+k+1] // Move down: insert from b
+			} else {
+				px = vf[off+k-1] + 1 // Move right: delete from a
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[aLo+px] == d.b[bLo+py] {
+				px++
+				py++
+			}
+			vf[off+k] = px
+			if kb := delta - k; odd && kb >= -(D-1) && kb <= D-1 && px+vb[off+kb] >= n {
+				return aLo + sx, bLo + sy, aLo + px, bLo + py
+			}
+		}
+
+		for k := -D; k <= D; k += 2 {
+			var px int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				px = vb[off+k+1]
+			} else {
+				px = vb[off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[aHi-px-1] == d.b[bHi-py-1] {
+				px++
+				py++
+			}
+			vb[off+k] = px
+			if kf := delta - k; !odd && kf >= -D && kf <= D && vf[off+kf]+px >= n {
+				return aHi - px, bHi - py, aHi - sx, bHi - sy
+			}
+		}
+	}
+	// Unreachable: an optimal path always has a middle snake
+	return aLo, bLo, aLo, bLo
+}
+
+// Options controls unified diff output
+type Options struct {
+	Context int  // Lines of context around each change
+	Color   bool // Color removed, added and hunk header lines
+}
+
+// DefaultOptions matches the defaults of diff -u
+var DefaultOptions = Options{Context: 3}
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// Unified writes the differences between a and b in unified format, with
+// aName and bName as file headers. It returns false and writes nothing if
+// the texts are equal.
+func Unified(w io.Writer, aName, bName string, a, b []string, opts Options) bool {
+	edits := Lines(a, b)
+
+	changed := false
+	for _, e := range edits {
+		if e.Op != Equal {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false
+	}
+
+	paint := func(color, s string) string {
+		if !opts.Color {
+			return s
+		}
+		return color + s + colorReset
+	}
+
+	fmt.Fprintln(w, paint(colorBold, "--- "+aName))
+	fmt.Fprintln(w, paint(colorBold, "+++ "+bName))
+
+	for _, h := range hunks(edits, opts.Context) {
+		fmt.Fprintln(w, paint(colorCyan, fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))))
+		for _, e := range h.edits {
+			prefix, color := " ", ""
+			switch e.Op {
+			case Delete:
+				prefix, color = "-", colorRed
+			case Insert:
+				prefix, color = "+", colorGreen
+			}
+
+			line := strings.TrimSuffix(e.Line, "\n")
+			if color != "" {
+				line = paint(color, prefix+line)
+			} else {
+				line = prefix + line
+			}
+			fmt.Fprintln(w, line)
+			if !strings.HasSuffix(e.Line, "\n") {
+				fmt.Fprintln(w, `\ No newline at end of file`)
+			}
+		}
+	}
+	return true
+}
+
+// hunk is a group of edits with surrounding context
+type hunk struct {
+	aStart, aLen int // 1-based start line and length in a
+	bStart, bLen int
+	edits        []Edit
+}
+
+// hunks groups an edit script into hunks, merging changes that are separated
+// by no more than 2*context equal lines
+func hunks(edits []Edit, context int) []hunk {
+	var result []hunk
+
+	// Line numbers (0-based) in a and b before each edit
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.Op != Insert {
+			aLine[i+1]++
+		}
+		if e.Op != Delete {
+			bLine[i+1]++
+		}
+	}
+
+	i := 0
+	for i < len(edits) {
+		// Find the next change
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			// Extend past this change
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			// Count the equal lines that follow
+			run := 0
+			for end+run < len(edits) && edits[end+run].Op == Equal {
+				run++
+			}
+			if end+run == len(edits) || run > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end += run
+		}
+
+		h := hunk{
+			aStart: aLine[start] + 1,
+			aLen:   aLine[end] - aLine[start],
+			bStart: bLine[start] + 1,
+			bLen:   bLine[end] - bLine[start],
+			edits:  edits[start:end],
+		}
+		result = append(result, h)
+		i = end
+	}
+	return result
+}
+
+// hunkRange formats a hunk range as "start,len", following diff -u: an
+// empty range names the line before it
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, length)
+	}
+}
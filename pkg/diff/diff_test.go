@@ -0,0 +1,196 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLines(t *testing.T) {
+	a := SplitLines("a\nb\nc\nd\n")
+	b := SplitLines("a\nc\nd\ne\n")
+
+	var got []string
+	for _, e := range Lines(a, b) {
+		prefix := map[Op]string{Equal: " ", Delete: "-", Insert: "+"}[e.Op]
+		got = append(got, prefix+strings.TrimSuffix(e.Line, "\n"))
+	}
+
+	expected := []string{" a", "-b", " c", " d", "+e"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestLinesEmpty(t *testing.T) {
+	if edits := Lines(nil, nil); len(edits) != 0 {
+		t.Errorf("Expected no edits, got %v", edits)
+	}
+
+	edits := Lines(nil, SplitLines("x\ny\n"))
+	if len(edits) != 2 || edits[0].Op != Insert || edits[1].Op != Insert {
+		t.Errorf("Expected two inserts, got %v", edits)
+	}
+}
+
+// checkScript fails unless edits turn a into b with as few changes as the
+// longest common subsequence allows
+func checkScript(t *testing.T, a, b []string, edits []Edit) {
+	t.Helper()
+	var gotA, gotB []string
+	changes := 0
+	for _, e := range edits {
+		if e.Op != Insert {
+			gotA = append(gotA, e.Line)
+		}
+		if e.Op != Delete {
+			gotB = append(gotB, e.Line)
+		}
+		if e.Op != Equal {
+			changes++
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("Edit script does not turn %q into %q: %v", a, b, edits)
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	if expected := len(a) + len(b) - 2*lcs[0][0]; changes != expected {
+		t.Errorf("Expected %d changes from %q to %q, got %d: %v", expected, a, b, changes, edits)
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return lines
+	}
+	for range 2000 {
+		a, b := random(), random()
+		checkScript(t, a, b, Lines(a, b))
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	// Two files with nothing in common take as many steps as they have
+	// lines, which must not cost memory for every step
+	var a, b []string
+	for i := range 5000 {
+		a = append(a, fmt.Sprintf("old %d\n", i))
+		b = append(b, fmt.Sprintf("new %d\n", i))
+	}
+	b[2500] = a[2500]
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := Lines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(edits) != 9999 {
+		t.Errorf("Expected 9999 edits, got %d", len(edits))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("Diffing 10000 lines allocated %d MB", alloc>>20)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, strings.Repeat("x", i)+"\n")
+	}
+	changed := append([]string(nil), lines...)
+	changed[1] = "changed\n"
+	changed[17] = "also changed\n"
+
+	var buf strings.Builder
+	if !Unified(&buf, "a/file", "b/file", lines, changed, DefaultOptions) {
+		t.Fatal("Unified should report a difference")
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "--- a/file\n+++ b/file\n") {
+		t.Errorf("Missing file headers:\n%s", out)
+	}
+	// The two changes are far apart, so they form separate hunks
+	if strings.Count(out, "@@ ") != 2 {
+		t.Errorf("Expected 2 hunks:\n%s", out)
+	}
+	if !strings.Contains(out, "@@ -1,5 +1,5 @@\n") || !strings.Contains(out, "@@ -15,6 +15,6 @@\n") {
+		t.Errorf("Unexpected hunk headers:\n%s", out)
+	}
+
+	buf.Reset()
+	if Unified(&buf, "a", "b", lines, lines, DefaultOptions) || buf.Len() != 0 {
+		t.Error("Equal input should produce no output")
+	}
+}
+
+func TestUnifiedNoNewline(t *testing.T) {
+	var buf strings.Builder
+	Unified(&buf, "a", "b", SplitLines("x\n"), SplitLines("x"), DefaultOptions)
+	if !strings.Contains(buf.String(), `\ No newline at end of file`) {
+		t.Errorf("Missing no-newline marker:\n%s", buf.String())
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if IsBinary([]byte("plain text\n")) {
+		t.Error("Text should not be binary")
+	}
+	if !IsBinary([]byte{'a', 0, 'b'}) {
+		t.Error("NUL bytes should mark content as binary")
+	}
+	if !IsBinary([]byte{0xff, 0xfe, 0xfd}) {
+		t.Error("Invalid UTF-8 should mark content as binary")
+	}
+}
+
+func TestTrees(t *testing.T) {
+	a := fstest.MapFS{
+		"keep.txt":    {Data: []byte("same")},
+		"edit.txt":    {Data: []byte("old")},
+		"gone.txt":    {Data: []byte("bye")},
+		"sub/nest.go": {Data: []byte("package sub")},
+	}
+	b := fstest.MapFS{
+		"keep.txt":    {Data: []byte("same")},
+		"edit.txt":    {Data: []byte("new")},
+		"new.txt":     {Data: []byte("hi")},
+		"sub/nest.go": {Data: []byte("package sub")},
+	}
+
+	changes, err := Trees(a, b)
+	if err != nil {
+		t.Fatalf("Trees failed: %v", err)
+	}
+
+	expected := []Change{{"edit.txt", Modified}, {"gone.txt", Removed}, {"new.txt", Added}}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Change %d: expected %v, got %v", i, expected[i], changes[i])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"bytes"
+	"io/fs"
+	"sort"
+)
+
+// ChangeKind describes how a path differs between two trees
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+	TypeChanged
+)
+
+// String returns the name of the change kind
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return "type changed"
+	}
+}
+
+// Change is a path that differs between two trees
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// Trees compares two directory trees recursively and returns the paths that
+// were added, removed or modified going from a to b, sorted by path. Files
+// of equal size are compared by content.
+func Trees(a, b fs.FS) ([]Change, error) {
+	aEntries, err := walkTree(a)
+	if err != nil {
+		return nil, err
+	}
+	bEntries, err := walkTree(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for path, aInfo := range aEntries {
+		bInfo, ok := bEntries[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{path, Removed})
+		case aInfo.Mode().Type() != bInfo.Mode().Type():
+			changes = append(changes, Change{path, TypeChanged})
+		case aInfo.Mode().IsRegular():
+			same, err := sameContent(a, b, path, aInfo, bInfo)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				changes = append(changes, Change{path, Modified})
+			}
+		}
+	}
+	for path := range bEntries {
+		if _, ok := aEntries[path]; !ok {
+			changes = append(changes, Change{path, Added})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// walkTree returns every path below the root of fsys with its file info
+func walkTree(fsys fs.FS) (map[string]fs.FileInfo, error) {
+	entries := map[string]fs.FileInfo{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries[path] = info
+		return nil
+	})
+	return entries, err
+}
+
+func sameContent(a, b fs.FS, path string, aInfo, bInfo fs.FileInfo) (bool, error) {
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+	aData, err := fs.ReadFile(a, path)
+	if err != nil {
+		return false, err
+	}
+	bData, err := fs.ReadFile(b, path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
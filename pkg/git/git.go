@@ -0,0 +1,158 @@
+// Package git asks the local git binary about files before they are
+// trashed: whether they are in a work tree, and whether git holds a copy.
+package git
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// State describes a path relative to the last commit
+type State int
+
+const (
+	// NotInRepo means the path is outside any work tree, or git is missing
+	NotInRepo State = iota
+	// Clean means every file is tracked and unchanged, so git can bring it back
+	Clean
+	// Modified means tracked files have uncommitted changes
+	Modified
+	// Untracked means some files were never committed
+	Untracked
+	// Ignored means every file is ignored by git
+	Ignored
+)
+
+func (s State) String() string {
+	switch s {
+	case Clean:
+		return "clean"
+	case Modified:
+		return "modified"
+	case Untracked:
+		return "untracked"
+	case Ignored:
+		return "ignored"
+	}
+	return "not in repo"
+}
+
+// Status is what git knows about a path
+type Status struct {
+	State State
+	Root  string   // Work tree root
+	Head  string   // HEAD commit, empty before the first commit
+	Path  string   // Path relative to Root
+	Dirty []string // Modified, untracked or ignored files, relative to Root
+}
+
+// Check asks git about a file or directory. A missing git binary, or a path
+// outside any work tree, gives NotInRepo rather than an error.
+func Check(path string) (Status, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Status{}, err
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Status{}, err
+	}
+
+	dir := absPath
+	if !info.IsDir() {
+		dir = filepath.Dir(absPath)
+	}
+	root, err := run(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return Status{}, nil
+	}
+	root = strings.TrimSpace(root)
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	// git reports paths relative to the real root, so resolve symlinks in
+	// the parent the same way
+	parent, err := filepath.EvalSymlinks(filepath.Dir(absPath))
+	if err != nil {
+		return Status{}, err
+	}
+	rel, err := filepath.Rel(root, filepath.Join(parent, filepath.Base(absPath)))
+	if err != nil || rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return Status{}, nil
+	}
+
+	status := Status{Root: root, Path: rel}
+	if head, err := run(root, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		status.Head = strings.TrimSpace(head)
+	}
+
+	out, err := run(root, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--ignored=matching", "--", rel)
+	if err != nil {
+		return Status{}, err
+	}
+	modified, untracked, ignored := false, false, false
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code, file := entry[:2], entry[3:]
+		if code[0] == 'R' || code[0] == 'C' {
+			// Renames and copies are followed by the original path
+			i++
+		}
+		switch code {
+		case "!!":
+			ignored = true
+		case "??":
+			untracked = true
+		default:
+			modified = true
+		}
+		status.Dirty = append(status.Dirty, file)
+	}
+
+	tracked, err := run(root, "ls-files", "-z", "--", rel)
+	if err != nil {
+		return Status{}, err
+	}
+
+	switch {
+	case modified:
+		status.State = Modified
+	case untracked:
+		status.State = Untracked
+	case tracked != "" && ignored:
+		// git has no copy of the ignored files next to the tracked ones
+		status.State = Untracked
+	case tracked != "":
+		status.State = Clean
+	case ignored:
+		status.State = Ignored
+	default:
+		// Nothing git knows about, such as an empty directory
+		status.State = Untracked
+	}
+	return status, nil
+}
+
+// run runs git in dir and returns its standard output
+func run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
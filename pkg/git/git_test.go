@@ -0,0 +1,120 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// initRepo creates a work tree with one commit holding committed.txt and
+// src/main.go, and an ignore rule for *.log
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"committed.txt": "hello\n",
+		"src/main.go":   "package main\n",
+		".gitignore":    "*.log\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestCheck(t *testing.T) {
+	dir := initRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "debug.log"), []byte("log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main // edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want State
+	}{
+		{"committed.txt", Clean},
+		{"src/main.go", Modified},
+		{"src", Modified},
+		{"new.txt", Untracked},
+		{"debug.log", Ignored},
+		{".", Modified},
+	}
+	for _, tt := range tests {
+		status, err := Check(filepath.Join(dir, tt.path))
+		if err != nil {
+			t.Fatalf("Check(%s) error: %v", tt.path, err)
+		}
+		if status.State != tt.want {
+			t.Errorf("Check(%s) = %v, want %v", tt.path, status.State, tt.want)
+		}
+		if status.Head == "" {
+			t.Errorf("Check(%s) has no HEAD commit", tt.path)
+		}
+	}
+}
+
+func TestCheckTrackedWithIgnored(t *testing.T) {
+	dir := initRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "src", "build.log"), []byte("log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// git cannot bring back the ignored log, so the directory is not clean
+	status, err := Check(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != Untracked {
+		t.Errorf("State = %v, want untracked", status.State)
+	}
+	if status.Path != "src" {
+		t.Errorf("Path = %q, want src", status.Path)
+	}
+}
+
+func TestCheckNotInRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err := Check(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != NotInRepo {
+		t.Errorf("State = %v, want not in repo", status.State)
+	}
+}
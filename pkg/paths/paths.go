@@ -0,0 +1,17 @@
+// Package paths holds path helpers shared by the other packages
+package paths
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Within reports whether path is root or lies inside it. Both are compared
+// lexically, so they should be absolute and free of symlink surprises.
+func Within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
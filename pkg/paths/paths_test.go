@@ -0,0 +1,28 @@
+package paths
+
+import "testing"
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		root     string
+		path     string
+		expected bool
+	}{
+		{"/home/me", "/home/me", true},
+		{"/home/me", "/home/me/docs/a.txt", true},
+		{"/home/me", "/home/me/..foo", true},
+		{"/home/me", "/home/me/...", true},
+		{"/home/me", "/home/me/docs/../b", true},
+		{"/home/me", "/home", false},
+		{"/home/me", "/home/me2", false},
+		{"/home/me", "/home/other/x", false},
+		{"/home/me", "/", false},
+		{"/", "/anything", true},
+		{"/home/me", "relative", false},
+	}
+	for _, tt := range tests {
+		if got := Within(tt.root, tt.path); got != tt.expected {
+			t.Errorf("Within(%q, %q) = %v, expected %v", tt.root, tt.path, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package project finds git checkouts that keep their own trash. A project
+// trash lives in .rc-trash/ at the root of the checkout, so trashed files
+// stay on the same filesystem and cleanup stays scoped to the project.
+package project
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cj3636/GoCycled/pkg/paths"
+)
+
+// TrashDirName is the directory at the checkout root that holds the trash
+const TrashDirName = ".rc-trash"
+
+// MarkerName is the file at the checkout root that turns the project trash
+// on for that checkout
+const MarkerName = ".rc-project"
+
+// Root returns the root of the git checkout containing dir: the nearest
+// directory with a .git entry, which is a file in worktrees and submodules
+func Root(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Enabled reports whether the checkout at root uses a project trash: it has
+// a marker file, or it matches one of patterns. A pattern matches a root
+// that it names, that is inside it, or that it matches as a glob; "*"
+// matches every checkout.
+func Enabled(root string, patterns []string) bool {
+	if _, err := os.Stat(filepath.Join(root, MarkerName)); err == nil {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		pattern = filepath.Clean(pattern)
+		if ok, _ := filepath.Match(pattern, root); ok {
+			return true
+		}
+		if paths.Within(pattern, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrashDir returns the project trash directory of the checkout at root
+func TrashDir(root string) string {
+	return filepath.Join(root, TrashDirName)
+}
+
+// Prepare creates the project trash with a .gitignore that hides it from
+// git, so trashed files never show up as untracked
+func Prepare(root string) error {
+	dir := TrashDir(root)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	ignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignore); err == nil {
+		return nil
+	}
+	return os.WriteFile(ignore, []byte("*\n"), 0644)
+}
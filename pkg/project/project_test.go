@@ -0,0 +1,87 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	tempDir := t.TempDir()
+	repo := filepath.Join(tempDir, "repo")
+	sub := filepath.Join(repo, "src", "pkg")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("Failed to create dirs: %v", err)
+	}
+	os.Mkdir(filepath.Join(repo, ".git"), 0755)
+
+	// Worktrees and submodules have a .git file instead of a directory
+	worktree := filepath.Join(tempDir, "worktree")
+	os.Mkdir(worktree, 0755)
+	os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: ../repo/.git/worktrees/wt\n"), 0644)
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{sub, repo},
+		{repo, repo},
+		{worktree, worktree},
+		{tempDir, ""},
+	}
+	for _, tt := range tests {
+		root, ok := Root(tt.dir)
+		if root != tt.expected || ok != (tt.expected != "") {
+			t.Errorf("Root(%s) = %q, %v; expected %q", tt.dir, root, ok, tt.expected)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tempDir := t.TempDir()
+	marked := filepath.Join(tempDir, "marked")
+	plain := filepath.Join(tempDir, "src", "plain")
+	os.MkdirAll(marked, 0755)
+	os.MkdirAll(plain, 0755)
+	os.WriteFile(filepath.Join(marked, MarkerName), nil, 0644)
+
+	tests := []struct {
+		root     string
+		patterns []string
+		expected bool
+	}{
+		{marked, nil, true},
+		{plain, nil, false},
+		{plain, []string{"*"}, true},
+		{plain, []string{filepath.Join(tempDir, "src")}, true},
+		{plain, []string{filepath.Join(tempDir, "src", "pl*")}, true},
+		{plain, []string{filepath.Join(tempDir, "other")}, false},
+		{plain, []string{filepath.Join(tempDir, "sr")}, false},
+	}
+	for _, tt := range tests {
+		if got := Enabled(tt.root, tt.patterns); got != tt.expected {
+			t.Errorf("Enabled(%s, %v) = %v, expected %v", tt.root, tt.patterns, got, tt.expected)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	root := t.TempDir()
+	if err := Prepare(root); err != nil {
+		t.Fatalf("Failed to prepare project trash: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(TrashDir(root), ".gitignore"))
+	if err != nil || string(data) != "*\n" {
+		t.Errorf("Expected a .gitignore ignoring everything, got %q, %v", data, err)
+	}
+
+	// A customised .gitignore is left alone
+	os.WriteFile(filepath.Join(TrashDir(root), ".gitignore"), []byte("custom\n"), 0644)
+	if err := Prepare(root); err != nil {
+		t.Fatalf("Failed to prepare project trash again: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(TrashDir(root), ".gitignore")); string(data) != "custom\n" {
+		t.Errorf("Prepare should not overwrite .gitignore, got %q", data)
+	}
+}
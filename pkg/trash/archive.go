@@ -0,0 +1,352 @@
+package trash
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Archive writes items to w as a tar stream laid out like a trash:
+// info/NAME.json holds an item's metadata and files/NAME its content.
+// Symlinks, permissions, modification times and owners are kept, and files
+// of any size are stored.
+func (m *Manager) Archive(w io.Writer, trashNames []string) error {
+	tw := tar.NewWriter(w)
+	for _, name := range trashNames {
+		if err := m.archiveItem(tw, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return tw.Close()
+}
+
+func (m *Manager) archiveItem(tw *tar.Writer, trashName string) error {
+	item, err := m.loadItemInfo(filepath.Join(m.infoDir, trashName+".json"))
+	if err != nil {
+		return wrapNotExist(err)
+	}
+	if item.Compression == CompressionSealed {
+		return ErrEncrypted
+	}
+
+	// Metadata comes first, so Unarchive knows the item before its content
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "info/" + trashName + ".json",
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  item.DeletedAt,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	return writeTree(tw, filepath.Join(m.filesDir, trashName), "files/"+trashName)
+}
+
+// writeTree writes the file, symlink or directory tree at root to tw, with
+// entry names under prefix. An empty prefix names the root "./".
+func writeTree(tw *tar.Writer, root, prefix string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return wrapNotExist(err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case !info.IsDir() && !info.Mode().IsRegular():
+			return fmt.Errorf("cannot archive special file: %s", p)
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		hdr.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// unarchived is an item being read back by Unarchive
+type unarchived struct {
+	item      Item
+	dest      string // Name in files/
+	source    string // Name in the archive
+	duplicate bool
+	content   bool
+	err       error
+}
+
+// Unarchive reads an archive written by Archive back into the trash, with
+// the items' original paths and deletion times. Items already in the trash
+// are skipped with ErrDuplicate, and items that cannot be read are reported
+// in the results. It returns an error, keeping nothing, if the archive
+// itself is unreadable.
+func (m *Manager) Unarchive(r io.Reader) ([]Result, error) {
+	if m.Encrypted() {
+		return nil, ErrEncrypted
+	}
+	existing, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, item := range existing {
+		seen[duplicateKey(item)] = true
+	}
+
+	var order []*unarchived
+	pending := map[string]*unarchived{}
+	taken := map[string]bool{}
+	symlinks := map[string]bool{}
+	dirs := map[string]*tar.Header{}
+	var failed []Result
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			for _, u := range order {
+				if u.dest != "" {
+					os.RemoveAll(filepath.Join(m.filesDir, u.dest))
+				}
+			}
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+
+		kind, name, rest, ok := splitArchiveName(hdr.Name)
+		if !ok {
+			failed = append(failed, Result{Source: hdr.Name, Err: errors.New("unexpected entry")})
+			continue
+		}
+
+		if kind == "info" {
+			if _, dup := pending[name]; dup {
+				continue
+			}
+			u := &unarchived{source: name}
+			pending[name] = u
+			order = append(order, u)
+			if err := json.NewDecoder(tr).Decode(&u.item); err != nil {
+				u.err = fmt.Errorf("invalid metadata: %v", err)
+				continue
+			}
+			if seen[duplicateKey(u.item)] {
+				u.duplicate = true
+				continue
+			}
+			seen[duplicateKey(u.item)] = true
+			u.dest = uniqueName(m.filesDir, name, taken)
+			taken[u.dest] = true
+			continue
+		}
+
+		u, ok := pending[name]
+		if !ok {
+			if rest == "" {
+				failed = append(failed, Result{Source: hdr.Name, Err: errors.New("no metadata")})
+			}
+			continue
+		}
+		if u.duplicate || u.err != nil {
+			continue
+		}
+
+		// Never write through a symlink that the archive itself created
+		if insideSymlink(symlinks, name, rest) {
+			u.err = fmt.Errorf("entry inside a symlink: %s", hdr.Name)
+			continue
+		}
+
+		target := filepath.Join(m.filesDir, u.dest, filepath.FromSlash(rest))
+		if hdr.Typeflag == tar.TypeSymlink {
+			symlinks[path.Join(name, rest)] = true
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs[target] = hdr
+		}
+		if err := m.checkRoom(hdr.Size); err != nil {
+			u.err = err
+			continue
+		}
+		if err := extractEntry(tr, hdr, target); err != nil {
+			u.err = err
+			continue
+		}
+		u.content = true
+	}
+
+	// Directory modes and times last, deepest first: creating their
+	// entries needed write access and changed the times
+	paths := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		paths = append(paths, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, dir := range paths {
+		os.Chmod(dir, os.FileMode(dirs[dir].Mode).Perm())
+		os.Chtimes(dir, dirs[dir].ModTime, dirs[dir].ModTime)
+	}
+
+	results := failed
+	for _, u := range order {
+		result := Result{OriginalPath: u.item.OriginalPath, Source: u.source}
+		switch {
+		case u.duplicate:
+			result.Err = ErrDuplicate
+		case u.err == nil && !u.content:
+			result.Err = errors.New("no content in archive")
+		case u.err == nil:
+			result.Dest = filepath.Join(m.filesDir, u.dest)
+			result.Err = m.finishUnarchive(u, result.Dest)
+		}
+		if u.err != nil {
+			result.Err = u.err
+		}
+		if result.Err != nil && u.dest != "" {
+			os.RemoveAll(filepath.Join(m.filesDir, u.dest))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// finishUnarchive records an item whose content is in place
+func (m *Manager) finishUnarchive(u *unarchived, trashPath string) error {
+	item := u.item
+	item.TrashPath = trashPath
+	if info, err := os.Lstat(trashPath); err == nil && item.Size == 0 {
+		item.Size = PathSize(trashPath, info)
+	}
+
+	// Shared files come back as copies of their own, with their own times
+	for _, blob := range item.Blobs {
+		if fs.ValidPath(blob.Path) {
+			p := filepath.Join(trashPath, filepath.FromSlash(blob.Path))
+			os.Chtimes(p, blob.ModTime, blob.ModTime)
+		}
+	}
+	item.Blobs = nil
+	return m.saveItemInfo(filepath.Join(m.infoDir, u.dest+".json"), item)
+}
+
+// splitArchiveName splits "info/NAME.json" or "files/NAME/rest" into its
+// parts, rejecting names that would escape the trash
+func splitArchiveName(name string) (kind, item, rest string, ok bool) {
+	name = strings.TrimSuffix(name, "/")
+	if !fs.ValidPath(name) {
+		return "", "", "", false
+	}
+	kind, name, found := strings.Cut(name, "/")
+	if !found {
+		return "", "", "", false
+	}
+	switch kind {
+	case "info":
+		item, ok = strings.CutSuffix(name, ".json")
+		return kind, item, "", ok && !strings.Contains(item, "/")
+	case "files":
+		item, rest, _ = strings.Cut(name, "/")
+		return kind, item, rest, true
+	}
+	return "", "", "", false
+}
+
+// insideSymlink reports whether rest, inside item, lies below a symlink
+// created from the archive
+func insideSymlink(symlinks map[string]bool, item, rest string) bool {
+	for dir := rest; dir != "." && dir != ""; {
+		dir = path.Dir(dir)
+		if symlinks[path.Join(item, dir)] {
+			return true
+		}
+	}
+	return false
+}
+
+// extractEntry writes one tar entry to target
+func extractEntry(r io.Reader, hdr *tar.Header, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// The final mode is set once the directory's entries are written
+		if err := os.Mkdir(target, mode|0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported entry type %q: %s", hdr.Typeflag, hdr.Name)
+	}
+
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
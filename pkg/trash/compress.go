@@ -0,0 +1,477 @@
+package trash
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How an item's content is stored, as recorded in Item.Compression
+const (
+	// CompressionNone marks an item that compression did not shrink, so it
+	// is not tried again
+	CompressionNone = "none"
+	// CompressionGzip stores a single file gzipped
+	CompressionGzip = "gzip"
+	// CompressionTarGzip stores a directory as a gzipped tarball
+	CompressionTarGzip = "tar.gz"
+)
+
+// CompressPolicy selects the items Compress shrinks
+type CompressPolicy struct {
+	MinAge  time.Duration // Only items trashed longer ago; 0 turns compression off
+	MinSize int64         // Only items of at least this many bytes
+}
+
+// Compressed reports whether the item's content is stored compressed
+func (i Item) Compressed() bool {
+	return i.Compression == CompressionGzip || i.Compression == CompressionTarGzip || i.Compression == CompressionSealed
+}
+
+// DiskSize returns the bytes the item takes up in the trash
+func (i Item) DiskSize() int64 {
+	if i.Compressed() {
+		return i.StoredSize
+	}
+	return i.Size
+}
+
+// IsDir reports whether the item is a directory, even when it is stored
+// as a tarball
+func (i Item) IsDir() bool {
+	switch i.Compression {
+	case CompressionTarGzip:
+		return true
+	case CompressionGzip:
+		return false
+	case CompressionSealed:
+		return i.Dir
+	}
+	info, err := os.Lstat(i.TrashPath)
+	return err == nil && info.IsDir()
+}
+
+// Compress compresses, in place, the files and directories that policy
+// selects and returns the items it shrank. Items that compression would
+// not make smaller are left as they are and marked, so they are not tried
+// again. Restore, Open and ItemFS read compressed items transparently.
+func (m *Manager) Compress(policy CompressPolicy, now time.Time) ([]Item, error) {
+	if policy.MinAge <= 0 {
+		return nil, nil
+	}
+	items, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed []Item
+	for _, item := range items {
+		if item.Compression != "" || item.Size < policy.MinSize || now.Sub(item.DeletedAt) <= policy.MinAge {
+			continue
+		}
+		item, err := m.compressItem(item)
+		if err != nil {
+			return compressed, fmt.Errorf("%s: %w", item.OriginalPath, err)
+		}
+		if item.Compressed() {
+			compressed = append(compressed, item)
+		}
+	}
+	return compressed, nil
+}
+
+// CompressItem compresses one item in place, whatever its age and size,
+// and returns it. Items already compressed or tried are left as they are.
+func (m *Manager) CompressItem(trashName string) (Item, error) {
+	item, err := m.loadItemInfo(filepath.Join(m.infoDir, trashName+".json"))
+	if err != nil {
+		return Item{}, wrapNotExist(err)
+	}
+	if item.Compression != "" {
+		return item, nil
+	}
+	item.TrashPath = filepath.Join(m.filesDir, trashName)
+	return m.compressItem(item)
+}
+
+// compressItem writes the compressed form next to the item, then swaps it
+// in and records it
+func (m *Manager) compressItem(item Item) (Item, error) {
+	trashName := filepath.Base(item.TrashPath)
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	info, err := os.Lstat(item.TrashPath)
+	if err != nil {
+		return item, wrapNotExist(err)
+	}
+
+	var compression string
+	switch {
+	case info.Mode().IsRegular():
+		compression = CompressionGzip
+	case info.IsDir():
+		compression = CompressionTarGzip
+	default:
+		// Symlinks have nothing worth compressing
+		item.Compression = CompressionNone
+		return item, m.saveItemInfo(infoPath, item)
+	}
+
+	// Shared files keep their own times only once they are copies
+	if err := m.unshare(&item); err != nil {
+		return item, err
+	}
+
+	// The compressed copy sits next to the item until it replaces it, and
+	// is kept only if it is smaller
+	if err := m.checkRoom(item.Size); err != nil {
+		return item, err
+	}
+	tmp, err := os.CreateTemp(m.filesDir, ".compress-*")
+	if err != nil {
+		return item, err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if compression == CompressionGzip {
+		err = gzipFile(zw, item.TrashPath)
+	} else {
+		tw := tar.NewWriter(zw)
+		if err = writeTree(tw, item.TrashPath, ""); err == nil {
+			err = tw.Close()
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return item, err
+	}
+
+	stored, err := os.Stat(tmp.Name())
+	if err != nil {
+		return item, err
+	}
+	if stored.Size() >= item.Size {
+		item.Compression = CompressionNone
+		return item, m.saveItemInfo(infoPath, item)
+	}
+
+	// The compressed file keeps the mode, time and owner of a single file,
+	// so restoring it can put them back
+	if compression == CompressionGzip {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+		copyOwner(tmp.Name(), info)
+		os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	} else {
+		m.chown(tmp.Name())
+	}
+
+	// A file can be replaced in one rename; a directory is moved aside first
+	old := item.TrashPath
+	if compression == CompressionTarGzip {
+		old = filepath.Join(m.filesDir, ".uncompressed-"+trashName)
+		if err := os.Rename(item.TrashPath, old); err != nil {
+			return item, err
+		}
+	}
+	if err := os.Rename(tmp.Name(), item.TrashPath); err != nil {
+		if old != item.TrashPath {
+			os.Rename(old, item.TrashPath)
+		}
+		return item, err
+	}
+
+	item.Compression = compression
+	item.StoredSize = stored.Size()
+	if err := m.saveItemInfo(infoPath, item); err != nil {
+		return item, err
+	}
+	if old != item.TrashPath {
+		return item, os.RemoveAll(old)
+	}
+	return item, nil
+}
+
+func gzipFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// decompressTo writes the content of a compressed item to dest, which must
+// not exist unless it is the item itself. It is built under a temporary
+// name next to dest first, so an interruption never leaves a partial file
+// at dest.
+func decompressTo(item Item, dest string) error {
+	f, err := os.Open(item.TrashPath)
+	if err != nil {
+		return wrapNotExist(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	dir, base := filepath.Split(dest)
+	if item.Compression == CompressionGzip {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(dir, "."+base+".restore-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, zr)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			return err
+		}
+		copyOwner(tmp.Name(), info)
+		if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), dest)
+	}
+
+	tmp, err := os.MkdirTemp(dir, "."+base+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractTree(zr, filepath.Join(tmp, base)); err != nil {
+		return err
+	}
+	if dest == item.TrashPath {
+		// Decompressing in place: the tarball makes way for the directory
+		if err := os.Remove(dest); err != nil {
+			return err
+		}
+	}
+	return os.Rename(filepath.Join(tmp, base), dest)
+}
+
+// extractTree extracts a tarball written by writeTree with an empty prefix
+// to dest, which must not exist: a directory tree, or a single file or
+// symlink
+func extractTree(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	symlinks := map[string]bool{}
+	dirs := map[string]*tar.Header{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimSuffix(hdr.Name, "/"))
+		if !fs.ValidPath(name) || insideSymlink(symlinks, ".", name) {
+			return fmt.Errorf("invalid entry in compressed item: %s", hdr.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dirs[target] = hdr
+		case tar.TypeSymlink:
+			symlinks[name] = true
+		}
+		if err := extractEntry(tr, hdr, target); err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		paths = append(paths, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, dir := range paths {
+		hdr := dirs[dir]
+		if os.Geteuid() == 0 {
+			os.Lchown(dir, hdr.Uid, hdr.Gid)
+		}
+		if err := os.Chmod(dir, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dir, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gzipReadCloser closes both the gzip reader and the file beneath it
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// openGzip opens a gzipped file for reading its content
+func openGzip(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, wrapNotExist(err)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gzipReadCloser{Reader: zr, file: f}, nil
+}
+
+// tarFS is a read-only view of a directory stored as a tarball. Listing
+// uses an index of the entries; opening a file reads it from the tarball.
+type tarFS struct {
+	open    func() (io.ReadCloser, error) // Opens the uncompressed tarball
+	entries map[string]*tar.Header
+}
+
+// newTarFS indexes the tarball that open returns
+func newTarFS(open func() (io.ReadCloser, error)) (*tarFS, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	t := &tarFS{open: open, entries: map[string]*tar.Header{}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := pathClean(hdr.Name)
+		if fs.ValidPath(name) {
+			t.entries[name] = hdr
+		}
+	}
+	if root, ok := t.entries["."]; !ok || root.Typeflag != tar.TypeDir {
+		return nil, errors.New("compressed item has no root directory")
+	}
+	return t, nil
+}
+
+func pathClean(name string) string {
+	return path.Clean(strings.TrimSuffix(name, "/"))
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	hdr, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := hdr.FileInfo()
+
+	if hdr.Typeflag == tar.TypeDir {
+		var children []fs.DirEntry
+		for child, h := range t.entries {
+			if child != "." && path.Dir(child) == name {
+				children = append(children, fs.FileInfoToDirEntry(h.FileInfo()))
+			}
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i].Name() < children[j].Name() })
+		return &tarDir{info: info, entries: children}, nil
+	}
+
+	r, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			r.Close()
+			if err == io.EOF {
+				err = fs.ErrNotExist
+			}
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if pathClean(h.Name) == name {
+			return &tarFile{Reader: tr, info: info, closer: r}, nil
+		}
+	}
+}
+
+// tarFile is a file being read from a tarball
+type tarFile struct {
+	io.Reader
+	info   fs.FileInfo
+	closer io.Closer
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *tarFile) Close() error               { return f.closer.Close() }
+
+// tarDir is a directory of a tarball
+type tarDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *tarDir) Close() error               { return nil }
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,137 @@
+package trash
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Open opens a trashed item for reading without restoring it. If inner is
+// not empty the item must be a directory and inner names a file inside it,
+// using slash-separated paths such as "src/main.go".
+func (m *Manager) Open(trashName, inner string) (io.ReadCloser, error) {
+	if inner == "" {
+		path, err := m.itemPath(trashName)
+		if err != nil {
+			return nil, err
+		}
+		if item, err := m.loadItemInfo(filepath.Join(m.infoDir, trashName+".json")); err == nil && item.Compressed() {
+			if item.IsDir() {
+				return nil, fmt.Errorf("%s is a directory", trashName)
+			}
+			if item.Compression == CompressionSealed {
+				return m.openSealedFile(item)
+			}
+			return openGzip(path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, wrapNotExist(err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", trashName)
+		}
+		return os.Open(path)
+	}
+
+	fsys, err := m.ItemFS(trashName)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.ValidPath(inner) {
+		return nil, fmt.Errorf("invalid path inside item: %s", inner)
+	}
+
+	f, err := fsys.Open(inner)
+	if err != nil {
+		return nil, wrapNotExist(err)
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("%s is a directory", inner)
+	}
+	return f, nil
+}
+
+// ItemFS returns a read-only view of a trashed directory, rooted at the
+// directory itself
+func (m *Manager) ItemFS(trashName string) (fs.FS, error) {
+	path, err := m.itemPath(trashName)
+	if err != nil {
+		return nil, err
+	}
+	if item, err := m.loadItemInfo(filepath.Join(m.infoDir, trashName+".json")); err == nil && item.Compressed() {
+		if item.Compression == CompressionSealed {
+			if item.Locked {
+				return nil, ErrNoKey
+			}
+			if !item.IsDir() {
+				return nil, fmt.Errorf("%w: %s", ErrNotDir, trashName)
+			}
+			return m.sealedFS(item)
+		}
+		if item.Compression != CompressionTarGzip {
+			return nil, fmt.Errorf("%w: %s", ErrNotDir, trashName)
+		}
+		return newTarFS(func() (io.ReadCloser, error) { return openGzip(path) })
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, wrapNotExist(err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDir, trashName)
+	}
+	return os.DirFS(path), nil
+}
+
+// Extract copies a single file out of a trashed directory to dest, leaving
+// the item in the trash. If dest is an existing directory the file keeps its
+// name inside it. Existing files are never overwritten.
+func (m *Manager) Extract(trashName, inner, dest string) error {
+	src, err := m.Open(trashName, inner)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, filepath.Base(filepath.FromSlash(inner)))
+	}
+
+	mode := fs.FileMode(0644)
+	if f, ok := src.(fs.File); ok {
+		if info, err := f.Stat(); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, dest)
+		}
+		return err
+	}
+
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
+
+// itemPath returns the location of a trashed item's content, checking that
+// the item exists
+func (m *Manager) itemPath(trashName string) (string, error) {
+	if trashName == "" || trashName != filepath.Base(trashName) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, trashName)
+	}
+	if _, err := os.Stat(filepath.Join(m.infoDir, trashName+".json")); err != nil {
+		return "", wrapNotExist(err)
+	}
+	return filepath.Join(m.filesDir, trashName), nil
+}
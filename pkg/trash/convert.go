@@ -0,0 +1,452 @@
+package trash
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/paths"
+)
+
+// Format is a trash layout that rc can import from or export to
+type Format string
+
+const (
+	// Freedesktop is the layout of the freedesktop.org trash specification,
+	// used by GNOME, KDE and others: files/NAME next to info/NAME.trashinfo
+	Freedesktop Format = "freedesktop"
+
+	// TrashCLI is trash-cli's layout. It follows the freedesktop one, and is
+	// also found in per-volume $topdir/.Trash-UID directories, whose paths
+	// are relative to $topdir.
+	TrashCLI Format = "trash-cli"
+
+	// JSON is rc's own layout, including trashes written by older versions
+	JSON Format = "json"
+)
+
+// ImportFormats are the formats Import reads, and ExportFormats the formats
+// Export writes
+var (
+	ImportFormats = []Format{Freedesktop, TrashCLI, JSON}
+	ExportFormats = []Format{Freedesktop, TrashCLI}
+)
+
+// trashInfoDate is the DeletionDate format of .trashinfo files, in local time
+const trashInfoDate = "2006-01-02T15:04:05"
+
+// Result is the outcome of converting one item
+type Result struct {
+	OriginalPath string // Empty if the metadata could not be read
+	Source       string // The metadata file or trashed file the item came from
+	Dest         string // Where the file went, or would go on a dry run
+	Err          error  // Why it was not converted; ErrDuplicate if already there
+}
+
+// foreignItem is an item of a trash that rc does not manage. TrashPath is
+// the trashed file in that trash.
+type foreignItem struct {
+	Item
+	infoPath string
+}
+
+// Import moves the items of the trash at dir, which is in the given format,
+// into this trash. Items already here, with the same original path and
+// deletion time, are skipped with ErrDuplicate. Items that cannot be
+// converted, including files without metadata, are reported in the results
+// and left where they are. With dryRun set, nothing is changed.
+func (m *Manager) Import(dir string, format Format, dryRun bool) ([]Result, error) {
+	if m.Encrypted() {
+		return nil, ErrEncrypted
+	}
+	foreign, results, err := readForeign(dir, format)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, item := range existing {
+		seen[duplicateKey(item)] = true
+	}
+
+	taken := map[string]bool{}
+	for _, f := range foreign {
+		result := Result{OriginalPath: f.OriginalPath, Source: f.infoPath}
+		if seen[duplicateKey(f.Item)] {
+			result.Err = ErrDuplicate
+			results = append(results, result)
+			continue
+		}
+
+		item, err := m.importItem(f, taken, dryRun)
+		result.Dest, result.Err = item.TrashPath, err
+		if err == nil {
+			seen[duplicateKey(f.Item)] = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importItem moves one foreign item into the trash. Names in taken are
+// treated as in use, so a dry run reports the names a real run would pick.
+func (m *Manager) importItem(f foreignItem, taken map[string]bool, dryRun bool) (Item, error) {
+	info, err := os.Lstat(f.TrashPath)
+	if err != nil {
+		return Item{}, wrapNotExist(err)
+	}
+
+	item := f.Item
+	if item.Size == 0 {
+		item.Size = PathSize(f.TrashPath, info)
+	}
+
+	// A freedesktop trash may share its files/ directory with this trash,
+	// in which case the file is already in place
+	name := filepath.Base(f.TrashPath)
+	if !sameDir(filepath.Dir(f.TrashPath), m.filesDir) {
+		name = uniqueName(m.filesDir, name, taken)
+	}
+	taken[name] = true
+	item.TrashPath = filepath.Join(m.filesDir, name)
+	item.Blobs = nil
+	if dryRun {
+		return item, nil
+	}
+
+	// Files linked into the other trash's blob store get copies of their own
+	for _, blob := range f.Blobs {
+		if !fs.ValidPath(blob.Path) {
+			continue
+		}
+		if err := m.copyOut(filepath.Join(f.TrashPath, filepath.FromSlash(blob.Path)), blob.ModTime); err != nil {
+			return Item{}, err
+		}
+	}
+
+	if item.TrashPath != f.TrashPath {
+		if err := moveFile(f.TrashPath, item.TrashPath, m.floor); err != nil {
+			return Item{}, err
+		}
+	}
+	if err := m.saveItemInfo(filepath.Join(m.infoDir, name+".json"), item); err != nil {
+		return Item{}, err
+	}
+	return item, os.Remove(f.infoPath)
+}
+
+// Export moves every item of this trash into the trash at dir, which is
+// created in the given format if needed. Items already there, with the same
+// original path and deletion time, are skipped with ErrDuplicate. With
+// dryRun set, nothing is changed.
+func (m *Manager) Export(dir string, format Format, dryRun bool) ([]Result, error) {
+	if format != Freedesktop && format != TrashCLI {
+		return nil, fmt.Errorf("cannot export to %s", format)
+	}
+
+	items, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.Before(items[j].DeletedAt) })
+
+	seen := map[string]bool{}
+	if _, err := os.Stat(dir); err == nil {
+		existing, _, err := readForeign(dir, format)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range existing {
+			seen[duplicateKey(f.Item)] = true
+		}
+	}
+
+	filesDir, infoDir := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	if !dryRun {
+		// The specification asks for trash directories only their owner can read
+		for _, d := range []string{filesDir, infoDir} {
+			if err := os.MkdirAll(d, 0700); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var results []Result
+	taken := map[string]bool{}
+	for _, item := range items {
+		trashName := filepath.Base(item.TrashPath)
+		result := Result{OriginalPath: item.OriginalPath, Source: filepath.Join(m.infoDir, trashName+".json")}
+		if seen[duplicateKey(item)] {
+			result.Err = ErrDuplicate
+			results = append(results, result)
+			continue
+		}
+		// Other trashes could only hold them decrypted
+		if item.Compression == CompressionSealed {
+			result.Err = ErrEncrypted
+			results = append(results, result)
+			continue
+		}
+
+		name := trashName
+		if !sameDir(filesDir, m.filesDir) {
+			name = uniqueName(filesDir, name, taken)
+		}
+		taken[name] = true
+		result.Dest = filepath.Join(filesDir, name)
+		if !dryRun {
+			result.Err = m.exportItem(item, result.Dest, filepath.Join(infoDir, name+".trashinfo"))
+		}
+		if result.Err == nil {
+			seen[duplicateKey(item)] = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// exportItem writes the .trashinfo file of an item, then moves the item and
+// drops its rc metadata. The info file comes first, as the specification
+// asks, and is created exclusively so that no other item is overwritten.
+func (m *Manager) exportItem(item Item, destPath, infoPath string) error {
+	trashName := filepath.Base(item.TrashPath)
+	if err := m.unshare(&item); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: item.OriginalPath}).EscapedPath(), item.DeletedAt.Local().Format(trashInfoDate))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(infoPath)
+		return err
+	}
+
+	// Other trashes know nothing of compression
+	switch {
+	case item.Compressed():
+		err = decompressTo(item, destPath)
+		if err == nil && !sameDir(destPath, item.TrashPath) {
+			err = os.Remove(item.TrashPath)
+		}
+	case destPath != item.TrashPath:
+		err = moveFile(item.TrashPath, destPath, m.floor)
+	}
+	if err != nil {
+		os.Remove(infoPath)
+		return err
+	}
+	return os.Remove(filepath.Join(m.infoDir, trashName+".json"))
+}
+
+// readForeign lists the items of the trash at dir. Metadata that cannot be
+// read, and trashed files without metadata, are returned as failed results.
+func readForeign(dir string, format Format) ([]foreignItem, []Result, error) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	var ext string
+	var parse func(path, filesDir string) (foreignItem, error)
+	switch format {
+	case Freedesktop, TrashCLI:
+		ext = ".trashinfo"
+		top := topDir(dir)
+		parse = func(path, filesDir string) (foreignItem, error) {
+			return readTrashInfo(path, filesDir, top)
+		}
+	case JSON:
+		ext = ".json"
+		parse = readJSONInfo
+	default:
+		return nil, nil, fmt.Errorf("unknown trash format: %s", format)
+	}
+
+	filesDir, infoDir := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	entries, err := os.ReadDir(infoDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not a %s trash: %w", dir, format, wrapNotExist(err))
+	}
+
+	var items []foreignItem
+	var failed []Result
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+		path := filepath.Join(infoDir, entry.Name())
+		item, err := parse(path, filesDir)
+		if err != nil {
+			failed = append(failed, Result{Source: path, Err: err})
+			continue
+		}
+		items = append(items, item)
+	}
+
+	// Files that neither layout describes cannot be restored by anyone
+	files, _ := os.ReadDir(filesDir)
+	for _, file := range files {
+		name := file.Name()
+		if fileExists(filepath.Join(infoDir, name+".trashinfo")) || fileExists(filepath.Join(infoDir, name+".json")) {
+			continue
+		}
+		failed = append(failed, Result{Source: filepath.Join(filesDir, name), Err: errors.New("no metadata")})
+	}
+	return items, failed, nil
+}
+
+// readTrashInfo parses a .trashinfo file. Relative paths, as written in
+// per-volume trashes, are relative to top.
+func readTrashInfo(path, filesDir, top string) (foreignItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return foreignItem{}, err
+	}
+	defer f.Close()
+
+	var original, deleted string
+	inGroup := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "["):
+			inGroup = line == "[Trash Info]"
+		case inGroup && strings.HasPrefix(line, "Path="):
+			original = strings.TrimPrefix(line, "Path=")
+		case inGroup && strings.HasPrefix(line, "DeletionDate="):
+			deleted = strings.TrimPrefix(line, "DeletionDate=")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return foreignItem{}, err
+	}
+
+	if original == "" {
+		return foreignItem{}, errors.New("missing Path")
+	}
+	original, err = url.PathUnescape(original)
+	if err != nil {
+		return foreignItem{}, fmt.Errorf("invalid Path: %v", err)
+	}
+	if !filepath.IsAbs(original) {
+		original = filepath.Join(top, original)
+	}
+	deletedAt, err := time.ParseInLocation(trashInfoDate, deleted, time.Local)
+	if err != nil {
+		return foreignItem{}, fmt.Errorf("invalid DeletionDate %q", deleted)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".trashinfo")
+	return foreignItem{
+		Item: Item{
+			OriginalPath: filepath.Clean(original),
+			TrashPath:    filepath.Join(filesDir, name),
+			DeletedAt:    deletedAt,
+		},
+		infoPath: path,
+	}, nil
+}
+
+// readJSONInfo parses rc metadata. Older versions recorded the trash path
+// of the directory the trash lived in at the time, so the file is looked up
+// next to the metadata first. The recorded path is only used inside the
+// trash being read, so metadata cannot point an import at other files.
+func readJSONInfo(path, filesDir string) (foreignItem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return foreignItem{}, err
+	}
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return foreignItem{}, fmt.Errorf("invalid metadata: %v", err)
+	}
+	if item.OriginalPath == "" {
+		return foreignItem{}, errors.New("missing original_path")
+	}
+
+	trashPath := filepath.Join(filesDir, strings.TrimSuffix(filepath.Base(path), ".json"))
+	if !fileExists(trashPath) && item.TrashPath != "" && fileExists(item.TrashPath) {
+		if !insideTrash(filepath.Dir(filesDir), item.TrashPath) {
+			return foreignItem{}, fmt.Errorf("trash_path outside the trash: %s", item.TrashPath)
+		}
+		trashPath = item.TrashPath
+	}
+	item.TrashPath = trashPath
+	return foreignItem{Item: item, infoPath: path}, nil
+}
+
+// insideTrash reports whether path lies within the trash at dir, once the
+// symlinks leading to it are resolved
+func insideTrash(dir, path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	path = filepath.Join(parent, filepath.Base(path))
+	return path != root && paths.Within(root, path)
+}
+
+// topDir returns the directory that relative paths in the trash at dir are
+// relative to: $topdir for $topdir/.Trash-UID and $topdir/.Trash/UID
+func topDir(dir string) string {
+	dir = filepath.Clean(dir)
+	parent := filepath.Dir(dir)
+	if filepath.Base(parent) == ".Trash" {
+		return filepath.Dir(parent)
+	}
+	return parent
+}
+
+// duplicateKey identifies an item across formats. The freedesktop format
+// keeps deletion times to the second.
+func duplicateKey(item Item) string {
+	return fmt.Sprintf("%s\x00%d", filepath.Clean(item.OriginalPath), item.DeletedAt.Unix())
+}
+
+// uniqueName returns name, or name with a counter, such that nothing in dir
+// or in taken uses it
+func uniqueName(dir, name string, taken map[string]bool) string {
+	candidate := name
+	for counter := 1; taken[candidate] || fileExists(filepath.Join(dir, candidate)); counter++ {
+		candidate = fmt.Sprintf("%s_%d", name, counter)
+	}
+	return candidate
+}
+
+// sameDir reports whether two paths name the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
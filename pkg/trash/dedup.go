@@ -0,0 +1,264 @@
+package trash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Blob is a file of a trashed item whose content lives in the trash's blob
+// store, shared by hardlink with every other trashed file of that content
+type Blob struct {
+	Path    string    `json:"path"` // Relative to the item; "." when the item is the file
+	Hash    string    `json:"hash"` // SHA-256 of the content, which names the blob
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"` // The file's own time; the shared inode keeps the first one's
+}
+
+// fileID identifies a file across its hardlinks
+type fileID struct {
+	dev, ino uint64
+}
+
+// dedupMinSize is the smallest file worth sharing: smaller files save
+// little and each still costs a blob
+const dedupMinSize = 4096
+
+// blobPath returns where the blob of a hash is stored, or "" for a hash
+// that is not one
+func (m *Manager) blobPath(hash string) string {
+	if len(hash) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return ""
+	}
+	return filepath.Join(m.blobsDir, hash[:2], hash)
+}
+
+// dedup replaces the files of a newly trashed item with hardlinks into the
+// blob store, so that content trashed before is kept only once. Files that
+// cannot be linked, whose blob has another mode or owner, or that still
+// have links outside the trash, through which they could change, stay as
+// they are: sharing is best effort and never fails a put.
+func (m *Manager) dedup(item *Item) {
+	if !hardlinks {
+		return
+	}
+	filepath.WalkDir(item.TrashPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() < dedupMinSize {
+			return nil
+		}
+		if _, links, ok := inode(info); !ok || links > 1 {
+			return nil
+		}
+		if blob, ok := m.share(p, info); ok {
+			rel, _ := filepath.Rel(item.TrashPath, p)
+			blob.Path = filepath.ToSlash(rel)
+			item.Blobs = append(item.Blobs, blob)
+		}
+		return nil
+	})
+}
+
+// share links the file at p into the blob store, or replaces it with a
+// link to the blob that already holds its content
+func (m *Manager) share(p string, info os.FileInfo) (Blob, bool) {
+	hash, err := hashFile(p)
+	if err != nil {
+		return Blob{}, false
+	}
+	blob := Blob{Hash: hash, Size: info.Size(), ModTime: info.ModTime()}
+	blobPath := m.blobPath(hash)
+
+	existing, err := os.Lstat(blobPath)
+	if os.IsNotExist(err) {
+		if err := mkdirAs(filepath.Dir(blobPath), m.owner); err != nil {
+			return Blob{}, false
+		}
+		return blob, os.Link(p, blobPath) == nil
+	}
+	if err != nil || existing.Size() != info.Size() || existing.Mode() != info.Mode() || !sameOwner(existing, info) {
+		return Blob{}, false
+	}
+	if os.SameFile(existing, info) {
+		return blob, true
+	}
+
+	// Link under a temporary name first, so the file is never missing
+	tmp := filepath.Join(filepath.Dir(p), ".rc-dedup-"+filepath.Base(p))
+	if err := os.Link(blobPath, tmp); err != nil {
+		return Blob{}, false
+	}
+	restoreTime := m.keepDirTime(p)
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return Blob{}, false
+	}
+	restoreTime()
+	return blob, true
+}
+
+// unshare gives every shared file of an item a copy of its own, with its
+// own modification time, and releases the blobs nothing links to any
+// more. Files must not leave the trash still linked to content that other
+// items share.
+func (m *Manager) unshare(item *Item) error {
+	for _, blob := range item.Blobs {
+		if !fs.ValidPath(blob.Path) {
+			continue
+		}
+		if err := m.copyOut(filepath.Join(item.TrashPath, filepath.FromSlash(blob.Path)), blob.ModTime); err != nil {
+			return err
+		}
+	}
+	blobs := item.Blobs
+	item.Blobs = nil
+	return m.release(blobs)
+}
+
+// copyOut replaces a hardlinked file with a copy of its own
+func (m *Manager) copyOut(p string, modTime time.Time) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return wrapNotExist(err)
+	}
+	if _, links, ok := inode(info); !ok || links < 2 {
+		return nil
+	}
+
+	if err := m.checkRoom(info.Size()); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(p), ".rc-unshare-"+filepath.Base(p))
+	err = copyFile(p, tmp, info.Mode().Perm())
+	if err == nil {
+		err = os.Chmod(tmp, info.Mode().Perm())
+	}
+	if err == nil {
+		err = copyOwner(tmp, info)
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, modTime, modTime)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	restoreTime := m.keepDirTime(p)
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	restoreTime()
+	return nil
+}
+
+// release removes the blobs that no trashed file links to any more
+func (m *Manager) release(blobs []Blob) error {
+	for _, blob := range blobs {
+		p := m.blobPath(blob.Hash)
+		if p == "" {
+			continue
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		if _, links, ok := inode(info); ok && links == 1 {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			// Fails while other blobs share the directory
+			os.Remove(filepath.Dir(p))
+		}
+	}
+	return nil
+}
+
+// keepDirTime notes the modification time of the directory holding p and
+// returns a function that puts it back, since replacing p changes it. The
+// trash's own files directory is left alone.
+func (m *Manager) keepDirTime(p string) func() {
+	dir := filepath.Dir(p)
+	info, err := os.Stat(dir)
+	if err != nil || filepath.Clean(dir) == filepath.Clean(m.filesDir) {
+		return func() {}
+	}
+	return func() {
+		os.Chtimes(dir, info.ModTime(), info.ModTime())
+	}
+}
+
+// sharedRefs counts how many trashed files use each blob
+func sharedRefs(items []Item) map[string]int {
+	refs := map[string]int{}
+	for _, item := range items {
+		for _, blob := range item.Blobs {
+			refs[blob.Hash]++
+		}
+	}
+	return refs
+}
+
+// diskUsage returns the bytes items take up, counting shared content once
+func diskUsage(items []Item) int64 {
+	var total int64
+	counted := map[string]bool{}
+	for _, item := range items {
+		total += item.DiskSize()
+		for _, blob := range item.Blobs {
+			if counted[blob.Hash] {
+				total -= blob.Size
+			}
+			counted[blob.Hash] = true
+		}
+	}
+	return total
+}
+
+// freedBy returns the bytes that removing item gives back, given the blob
+// references of every item still in the trash, and drops its references
+func freedBy(item Item, refs map[string]int) int64 {
+	freed := item.DiskSize()
+	for _, blob := range item.Blobs {
+		refs[blob.Hash]--
+		if refs[blob.Hash] > 0 {
+			freed -= blob.Size
+		}
+	}
+	return freed
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sameOwner reports whether two files have the same owner and group
+func sameOwner(a, b os.FileInfo) bool {
+	oa, ob := ownerOf(a), ownerOf(b)
+	if oa == nil || ob == nil {
+		return oa == ob
+	}
+	return *oa == *ob
+}
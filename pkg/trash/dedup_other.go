@@ -0,0 +1,14 @@
+//go:build !unix
+
+package trash
+
+import "os"
+
+// hardlinks is false where link counts are unknown, which turns
+// deduplication off
+const hardlinks = false
+
+// inode knows nothing about hardlinks on this platform
+func inode(info os.FileInfo) (fileID, uint64, bool) {
+	return fileID{}, 0, false
+}
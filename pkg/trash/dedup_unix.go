@@ -0,0 +1,21 @@
+//go:build unix
+
+package trash
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinks reports whether the blob store can count links to its blobs
+const hardlinks = true
+
+// inode returns the identity of a file, shared by its hardlinks, and the
+// number of links to it
+func inode(info os.FileInfo) (fileID, uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, 0, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, uint64(st.Nlink), true
+}
@@ -0,0 +1,69 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Sentinel errors returned by Manager operations. They are wrapped with
+// context, so callers should match them with errors.Is.
+var (
+	// ErrNotFound is returned when a path or trash item does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when restoring would overwrite an existing file
+	ErrConflict = errors.New("file already exists at original location")
+
+	// ErrCrossDevice is returned when a file cannot be renamed into the trash
+	// because it lives on a different filesystem
+	ErrCrossDevice = errors.New("cannot move across filesystems")
+
+	// ErrProtected is returned when asked to trash a path that must never be
+	// trashed, such as the root directory or the trash itself
+	ErrProtected = errors.New("refusing to trash protected path")
+
+	// ErrLocked is returned by Lock when another process holds the trash lock
+	ErrLocked = errors.New("trash is locked by another process")
+
+	// ErrDuplicate is returned for an item that the destination trash
+	// already holds, as when an import is run twice
+	ErrDuplicate = errors.New("already in trash")
+
+	// ErrNoKey is returned when an encrypted trash is used in a way that
+	// needs its key, and none was given
+	ErrNoKey = errors.New("encrypted trash needs its key")
+
+	// ErrWrongKey is returned when a key does not open an encrypted trash
+	ErrWrongKey = errors.New("wrong key for encrypted trash")
+
+	// ErrEncrypted is returned for operations that encrypted items do not
+	// support, such as moving them to another trash
+	ErrEncrypted = errors.New("not supported for encrypted items")
+
+	// ErrNotDir is returned when an item is read as a directory but holds
+	// a single file
+	ErrNotDir = errors.New("not a directory")
+
+	// ErrNoSpace is returned when writing to the trash would leave its
+	// filesystem with less free space than the floor it was given
+	ErrNoSpace = errors.New("not enough free space")
+)
+
+// wrapNotExist converts a "does not exist" error into ErrNotFound while
+// keeping the original error in the chain
+func wrapNotExist(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+// wrapRename converts a cross-device rename failure into ErrCrossDevice
+func wrapRename(err error) error {
+	if errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("%w: %w", ErrCrossDevice, err)
+	}
+	return wrapNotExist(err)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package trash
+
+// Lock is a no-op on platforms without flock(2)
+func (m *Manager) Lock() (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Lock takes an exclusive, non-blocking lock on the trash directory so that
+// concurrent rc processes don't modify it at the same time. It returns
+// ErrLocked if another process holds the lock. The returned function
+// releases the lock.
+func (m *Manager) Lock() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(m.trashDir, ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.chown(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: %s", ErrLocked, m.trashDir)
+		}
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
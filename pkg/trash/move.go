@@ -0,0 +1,134 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// MoveTo moves an item into another trash, keeping its metadata. The item
+// is copied when the two trashes are on different filesystems.
+func (m *Manager) MoveTo(trashName string, dest *Manager) (Item, error) {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	item, err := m.loadItemInfo(infoPath)
+	if err != nil {
+		return Item{}, wrapNotExist(err)
+	}
+	if item.Compression == CompressionSealed || dest.Encrypted() {
+		return Item{}, ErrEncrypted
+	}
+	// The other trash has its own blob store
+	if err := m.unshare(&item); err != nil {
+		return Item{}, err
+	}
+
+	// Keep the name unless the destination already has an item by it
+	destName := uniqueName(dest.filesDir, trashName, nil)
+
+	destPath := filepath.Join(dest.filesDir, destName)
+	if err := moveFile(item.TrashPath, destPath, dest.floor); err != nil {
+		return Item{}, err
+	}
+
+	item.TrashPath = destPath
+	if err := dest.saveItemInfo(filepath.Join(dest.infoDir, destName+".json"), item); err != nil {
+		return Item{}, err
+	}
+	return item, os.Remove(infoPath)
+}
+
+// moveFile renames src to dst, falling back to copying and removing src
+// when they are on different filesystems. The copy must leave floor bytes
+// free on dst's filesystem.
+func moveFile(src, dst string, floor int64) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return wrapNotExist(err)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if err := checkRoomIn(filepath.Dir(dst), PathSize(src, info), floor); err != nil {
+		return err
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree copies a file, symlink or directory tree, keeping permissions
+// and modification times
+func copyTree(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+	case info.Mode().IsRegular():
+		if err := copyFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("cannot copy special file: %s", src)
+	}
+
+	if err := copyOwner(dst, info); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,56 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// mkdirAs creates dir and any missing parents like os.MkdirAll, giving the
+// directories it creates to owner when one is set
+func mkdirAs(dir string, owner *Owner) error {
+	if owner == nil {
+		return os.MkdirAll(dir, 0755)
+	}
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAs(parent, owner); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.Lchown(dir, owner.UID, owner.GID)
+}
+
+// chown gives a file the manager creates to the manager's owner
+func (m *Manager) chown(path string) error {
+	if m.owner == nil {
+		return nil
+	}
+	return os.Lchown(path, m.owner.UID, m.owner.GID)
+}
+
+// restoreOwner gives a restored file back to its recorded owner. Only root
+// can do that; other users get the file as it is.
+func restoreOwner(path string, owner *Owner) error {
+	if owner == nil || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(path, owner.UID, owner.GID)
+}
+
+// copyOwner gives a copy the owner of the original when running as root
+func copyOwner(path string, info os.FileInfo) error {
+	owner := ownerOf(info)
+	if owner == nil || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(path, owner.UID, owner.GID)
+}
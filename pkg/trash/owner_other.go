@@ -0,0 +1,10 @@
+//go:build !unix
+
+package trash
+
+import "os"
+
+// ownerOf returns nil on platforms without Unix file ownership
+func ownerOf(info os.FileInfo) *Owner {
+	return nil
+}
@@ -0,0 +1,261 @@
+package trash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dropFile holds a drop's metadata inside its directory
+const dropFile = "drop.json"
+
+// Drop is a set of deleted items that the trash holds back in its
+// purgatory for a grace period, so that an undo can still bring them back.
+// Each drop keeps its items as files/NAME and info/NAME.json, like the
+// trash itself.
+type Drop struct {
+	ID        string        `json:"-"`
+	DroppedAt time.Time     `json:"dropped_at"`
+	ExpiresAt time.Time     `json:"expires_at"`      // When the items are deleted for good
+	Shred     *ShredOptions `json:"shred,omitempty"` // Shred the items once the drop expires
+	Items     []Item        `json:"-"`
+}
+
+// dropDir returns the directory of a drop
+func (m *Manager) dropDir(id string) string {
+	return filepath.Join(m.purgatoryDir, id)
+}
+
+// NewDrop starts an empty drop for items deleted now and held for grace.
+// Items whose drop carries shred options are shredded when it expires.
+func (m *Manager) NewDrop(now time.Time, grace time.Duration, shred *ShredOptions) (Drop, error) {
+	drop := Drop{
+		ID:        fmt.Sprintf("%s-%d", now.UTC().Format("20060102T150405.000000000"), os.Getpid()),
+		DroppedAt: now,
+		ExpiresAt: now.Add(grace),
+		Shred:     shred,
+	}
+	dir := m.dropDir(drop.ID)
+	for _, sub := range []string{"files", "info"} {
+		if err := mkdirAs(filepath.Join(dir, sub), m.owner); err != nil {
+			return Drop{}, err
+		}
+	}
+
+	data, err := json.MarshalIndent(drop, "", "  ")
+	if err != nil {
+		return Drop{}, err
+	}
+	path := filepath.Join(dir, dropFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return Drop{}, err
+	}
+	return drop, m.chown(path)
+}
+
+// MoveToPurgatory deletes an item into a drop, from which Undo can still
+// bring it back
+func (m *Manager) MoveToPurgatory(trashName string, drop Drop) error {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	if _, err := os.Stat(infoPath); err != nil {
+		return wrapNotExist(err)
+	}
+
+	dir := m.dropDir(drop.ID)
+	if err := os.Rename(filepath.Join(m.filesDir, trashName), filepath.Join(dir, "files", trashName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(infoPath, filepath.Join(dir, "info", trashName+".json"))
+}
+
+// EmptyToPurgatory empties the trash into a new drop and returns it
+func (m *Manager) EmptyToPurgatory(now time.Time, grace time.Duration, shred *ShredOptions) (Drop, error) {
+	items, err := m.List()
+	if err != nil {
+		return Drop{}, err
+	}
+	drop, err := m.NewDrop(now, grace, shred)
+	if err != nil {
+		return Drop{}, err
+	}
+	for _, item := range items {
+		if err := m.MoveToPurgatory(filepath.Base(item.TrashPath), drop); err != nil {
+			return drop, err
+		}
+		drop.Items = append(drop.Items, item)
+	}
+	return drop, nil
+}
+
+// Drops returns the drops in purgatory that hold items, oldest first
+func (m *Manager) Drops() ([]Drop, error) {
+	entries, err := os.ReadDir(m.purgatoryDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var drops []Drop
+	for _, entry := range entries {
+		drop, err := m.loadDrop(entry.Name())
+		if err != nil || len(drop.Items) == 0 {
+			continue
+		}
+		drops = append(drops, drop)
+	}
+	sort.Slice(drops, func(i, j int) bool {
+		return drops[i].DroppedAt.Before(drops[j].DroppedAt)
+	})
+	return drops, nil
+}
+
+// loadDrop reads a drop's metadata and items
+func (m *Manager) loadDrop(id string) (Drop, error) {
+	dir := m.dropDir(id)
+	data, err := os.ReadFile(filepath.Join(dir, dropFile))
+	if err != nil {
+		return Drop{}, err
+	}
+	var drop Drop
+	if err := json.Unmarshal(data, &drop); err != nil {
+		return Drop{}, err
+	}
+	drop.ID = id
+
+	entries, err := os.ReadDir(filepath.Join(dir, "info"))
+	if err != nil {
+		return Drop{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		item, err := m.loadItemInfo(filepath.Join(dir, "info", entry.Name()))
+		if err != nil {
+			continue
+		}
+		drop.Items = append(drop.Items, item)
+	}
+	return drop, nil
+}
+
+// Undo moves the items of a drop back into the trash and returns them.
+// Items that cannot come back stay in the drop.
+func (m *Manager) Undo(drop Drop) ([]Item, error) {
+	dir := m.dropDir(drop.ID)
+	entries, err := os.ReadDir(filepath.Join(dir, "info"))
+	if err != nil {
+		return nil, wrapNotExist(err)
+	}
+
+	var restored []Item
+	var firstErr error
+	for _, entry := range entries {
+		trashName, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		item, err := m.undoItem(dir, trashName)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		restored = append(restored, item)
+	}
+
+	if firstErr == nil {
+		firstErr = os.RemoveAll(dir)
+	}
+	return restored, firstErr
+}
+
+// undoItem moves one item of the drop at dir back into the trash
+func (m *Manager) undoItem(dir, trashName string) (Item, error) {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	trashPath := filepath.Join(m.filesDir, trashName)
+	if _, err := os.Lstat(infoPath); err == nil {
+		return Item{}, fmt.Errorf("%w: %s", ErrConflict, trashName)
+	}
+	if _, err := os.Lstat(trashPath); err == nil {
+		return Item{}, fmt.Errorf("%w: %s", ErrConflict, trashName)
+	}
+
+	if err := os.Rename(filepath.Join(dir, "files", trashName), trashPath); err != nil && !os.IsNotExist(err) {
+		return Item{}, err
+	}
+	if err := os.Rename(filepath.Join(dir, "info", trashName+".json"), infoPath); err != nil {
+		return Item{}, err
+	}
+	item, err := m.loadItemInfo(infoPath)
+	if err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// ExpireDrops permanently deletes the drops whose grace period is over,
+// shredding those that ask for it, and returns them
+func (m *Manager) ExpireDrops(now time.Time) ([]Drop, error) {
+	entries, err := os.ReadDir(m.purgatoryDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Drop
+	for _, entry := range entries {
+		drop, err := m.loadDrop(entry.Name())
+		if err != nil || now.Before(drop.ExpiresAt) {
+			continue
+		}
+		if err := m.deleteDrop(drop); err != nil {
+			return expired, err
+		}
+		if len(drop.Items) > 0 {
+			expired = append(expired, drop)
+		}
+	}
+	return expired, nil
+}
+
+// deleteDrop permanently deletes a drop and its items
+func (m *Manager) deleteDrop(drop Drop) error {
+	dir := m.dropDir(drop.ID)
+	entries, err := os.ReadDir(filepath.Join(dir, "info"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var trashPaths, infoPaths []string
+	for _, entry := range entries {
+		if trashName, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			trashPaths = append(trashPaths, filepath.Join(dir, "files", trashName))
+			infoPaths = append(infoPaths, filepath.Join(dir, "info", entry.Name()))
+		}
+	}
+
+	if drop.Shred != nil {
+		if err := m.shredItems(trashPaths, infoPaths, *drop.Shred); err != nil {
+			return err
+		}
+	} else {
+		for i := range trashPaths {
+			if err := m.deleteItem(trashPaths[i], infoPaths[i]); err != nil {
+				return err
+			}
+		}
+	}
+	// Fails while other drops are left
+	defer os.Remove(m.purgatoryDir)
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,127 @@
+package trash
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Policy limits what a trash keeps
+type Policy struct {
+	MaxAge  time.Duration // Items trashed longer ago are purged, unless they have their own expiry; 0 keeps them
+	MaxSize int64         // Items are evicted above this many bytes; 0 means no limit
+	Shred   *ShredOptions // Shred purged items instead of removing them, if set
+	MinFree int64         // Items are evicted while the filesystem has less free space; 0 means no minimum
+	Largest bool          // Evict the largest items first instead of the oldest
+
+	// MaxAgeFor, if set, replaces MaxAge for the items whose original path
+	// it reports a retention for
+	MaxAgeFor func(originalPath string) (time.Duration, bool)
+}
+
+// Purge permanently removes the items that policy no longer allows: first
+// those past their own expiry or, without one, older than MaxAge, then the
+// oldest remaining items, or the largest with Largest, until the trash fits
+// in MaxSize and its filesystem has MinFree bytes free. Short of space, it
+// deletes the drops held in purgatory, oldest first, before evicting any
+// item, and returns their items among the purged. Items trashed by this
+// manager are never evicted for size or space, so a put cannot purge
+// the file it just trashed, and pinned items are never purged at all.
+// Purge returns the items it removed.
+func (m *Manager) Purge(policy Policy, now time.Time) ([]Item, error) {
+	items, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.Before(items[j].DeletedAt)
+	})
+
+	// Content shared through the blob store counts once
+	refs := sharedRefs(items)
+	total := diskUsage(items)
+
+	// Space to free for the filesystem to have MinFree left
+	var short int64
+	if policy.MinFree > 0 {
+		if free, err := m.FreeSpace(); err == nil && free < policy.MinFree {
+			short = policy.MinFree - free
+		}
+	}
+
+	remove := m.Remove
+	if policy.Shred != nil {
+		remove = func(trashName string) error { return m.Shred(trashName, *policy.Shred) }
+	}
+
+	var purged, kept []Item
+	purge := func(item Item) error {
+		if err := remove(filepath.Base(item.TrashPath)); err != nil {
+			return err
+		}
+		freed := freedBy(item, refs)
+		total -= freed
+		short -= freed
+		purged = append(purged, item)
+		return nil
+	}
+
+	// Expired items go first, whatever the eviction order
+	for _, item := range items {
+		maxAge := policy.MaxAge
+		if policy.MaxAgeFor != nil {
+			if d, ok := policy.MaxAgeFor(item.OriginalPath); ok {
+				maxAge = d
+			}
+		}
+		expiry, expires := item.Expiry(maxAge)
+		if item.Pinned || !expires || !now.After(expiry) {
+			kept = append(kept, item)
+			continue
+		}
+		if err := purge(item); err != nil {
+			return purged, err
+		}
+	}
+
+	// Deleted items held only for undo go before anything still trashed
+	if short > 0 {
+		drops, err := m.Drops()
+		if err != nil {
+			return purged, err
+		}
+		for _, drop := range drops {
+			if short <= 0 {
+				break
+			}
+			if err := m.deleteDrop(drop); err != nil {
+				return purged, err
+			}
+			for _, item := range drop.Items {
+				short -= item.DiskSize()
+			}
+			purged = append(purged, drop.Items...)
+		}
+	}
+
+	// Then evict what is left until the limits are met
+	if policy.Largest {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].DiskSize() > kept[j].DiskSize()
+		})
+	}
+	for _, item := range kept {
+		if (policy.MaxSize == 0 || total <= policy.MaxSize) && short <= 0 {
+			break
+		}
+		if item.Pinned || item.Batch == m.batch {
+			continue
+		}
+		if err := purge(item); err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,477 @@
+package trash
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CompressionSealed stores a file or directory as an encrypted, gzipped
+// tarball. The item's metadata is sealed too.
+const CompressionSealed = "sealed"
+
+// sealFile holds an encrypted trash's key parameters, in the trash directory
+const sealFile = "seal.json"
+
+// sealMagic starts the content of every sealed item
+const sealMagic = "rcseal1\n"
+
+// Content is sealed in chunks, so items of any size stream through
+const sealChunk = 64 << 10
+
+// kdfIterations is the PBKDF2-SHA256 work factor for new trashes
+const kdfIterations = 600000
+
+// sealParams is how an encrypted trash derives its key from a passphrase
+// or key file, with a value sealed under the key to recognise it
+type sealParams struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check"`
+}
+
+// sealedInfo is the metadata file of a sealed item
+type sealedInfo struct {
+	Sealed []byte `json:"sealed"`
+}
+
+// Encrypted reports whether the trash seals its items, whether or not its
+// key has been given
+func (m *Manager) Encrypted() bool {
+	_, err := os.Stat(filepath.Join(m.trashDir, sealFile))
+	return err == nil
+}
+
+// HasKey reports whether UseKey has unlocked the trash
+func (m *Manager) HasKey() bool {
+	return m.aead != nil
+}
+
+// UseKey derives the trash's key from secret, a passphrase or the content
+// of a key file. From then on every item put is sealed, content and
+// metadata alike, and sealed items can be read and restored. The first call
+// on a trash makes it encrypted; later calls return ErrWrongKey for any
+// other secret.
+func (m *Manager) UseKey(secret []byte) error {
+	if len(secret) == 0 {
+		return ErrNoKey
+	}
+	path := filepath.Join(m.trashDir, sealFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m.createKey(path, secret)
+	}
+	if err != nil {
+		return err
+	}
+
+	var params sealParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return fmt.Errorf("invalid %s: %v", sealFile, err)
+	}
+	if params.Version != 1 || params.KDF != "pbkdf2-sha256" {
+		return fmt.Errorf("unsupported %s: version %d, kdf %s", sealFile, params.Version, params.KDF)
+	}
+	aead, err := deriveKey(secret, params)
+	if err != nil {
+		return err
+	}
+	if _, err := openSealed(aead, params.Check, []byte(sealFile)); err != nil {
+		return ErrWrongKey
+	}
+	m.aead = aead
+	return nil
+}
+
+// createKey picks the salt of a new encrypted trash and records it
+func (m *Manager) createKey(path string, secret []byte) error {
+	params := sealParams{Version: 1, KDF: "pbkdf2-sha256", Iterations: kdfIterations, Salt: make([]byte, 16)}
+	rand.Read(params.Salt)
+	aead, err := deriveKey(secret, params)
+	if err != nil {
+		return err
+	}
+	params.Check = seal(aead, nil, []byte(sealFile))
+
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	m.aead = aead
+	return m.chown(path)
+}
+
+func deriveKey(secret []byte, params sealParams) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(secret), params.Salt, params.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which it puts in front
+func seal(aead cipher.AEAD, plaintext, ad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, ad)
+}
+
+// openSealed decrypts what seal returned
+func openSealed(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
+
+// sealInfo encrypts an item's metadata, bound to its trash name
+func (m *Manager) sealInfo(item Item) ([]byte, error) {
+	if m.aead == nil {
+		return nil, ErrNoKey
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(item.TrashPath)
+	return json.MarshalIndent(sealedInfo{Sealed: seal(m.aead, data, []byte("info/"+name))}, "", "  ")
+}
+
+// openInfo decrypts the metadata of a sealed item. Without the key, only
+// what the file system shows anyway is known: the item's name, when its
+// metadata was written and how much space it takes.
+func (m *Manager) openInfo(path string, sealed []byte) (Item, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	if m.aead == nil {
+		item := Item{
+			TrashPath:   filepath.Join(m.filesDir, name),
+			Compression: CompressionSealed,
+			Locked:      true,
+		}
+		if info, err := os.Stat(path); err == nil {
+			item.DeletedAt = info.ModTime()
+		}
+		if info, err := os.Stat(item.TrashPath); err == nil {
+			item.Size, item.StoredSize = info.Size(), info.Size()
+		}
+		return item, nil
+	}
+
+	data, err := openSealed(m.aead, sealed, []byte("info/"+name))
+	if err != nil {
+		return Item{}, fmt.Errorf("%s: %w", name, ErrWrongKey)
+	}
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// putSealed encrypts a file or directory into the trash, then deletes the
+// original. Nothing unencrypted is written to the trash.
+func (m *Manager) putSealed(absPath string, info os.FileInfo, opts PutOptions) (Item, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	trashName := hex.EncodeToString(id)
+	trashPath := filepath.Join(m.filesDir, trashName)
+
+	// Sealing writes a copy, which compression only makes smaller
+	if err := m.checkRoom(PathSize(absPath, info)); err != nil {
+		return Item{}, err
+	}
+
+	tmp, err := os.CreateTemp(m.filesDir, ".seal-*")
+	if err != nil {
+		return Item{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	sw, err := m.newSealWriter(tmp, trashName)
+	if err == nil {
+		zw := gzip.NewWriter(sw)
+		tw := tar.NewWriter(zw)
+		err = writeTree(tw, absPath, "")
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		if err == nil {
+			err = sw.Close()
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Item{}, wrapNotExist(err)
+	}
+
+	stored, err := os.Stat(tmp.Name())
+	if err != nil {
+		return Item{}, err
+	}
+	if err := m.chown(tmp.Name()); err != nil {
+		return Item{}, err
+	}
+	if err := os.Rename(tmp.Name(), trashPath); err != nil {
+		return Item{}, err
+	}
+
+	item := Item{
+		OriginalPath: absPath,
+		TrashPath:    trashPath,
+		DeletedAt:    time.Now(),
+		Size:         PathSize(absPath, info),
+		Batch:        m.batch,
+		Git:          opts.Git,
+		Owner:        ownerOf(info),
+		Note:         opts.Note,
+		Tags:         opts.Tags,
+		ExpiresAt:    opts.ExpiresAt,
+		Compression:  CompressionSealed,
+		StoredSize:   stored.Size(),
+		Dir:          info.IsDir(),
+	}
+	if err := m.saveItemInfo(filepath.Join(m.infoDir, trashName+".json"), item); err != nil {
+		os.Remove(trashPath)
+		return Item{}, err
+	}
+
+	// The sealed copy is safe, so the original can go
+	return item, os.RemoveAll(absPath)
+}
+
+// unsealTo writes the content of a sealed item to dest, which must not
+// exist. It is built under a temporary name next to dest first.
+func (m *Manager) unsealTo(item Item, dest string) error {
+	r, err := m.openSealedItem(item)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dir, base := filepath.Split(dest)
+	tmp, err := os.MkdirTemp(dir, "."+base+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractTree(r, filepath.Join(tmp, base)); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(tmp, base), dest)
+}
+
+// openSealedItem returns the decrypted tarball of a sealed item
+func (m *Manager) openSealedItem(item Item) (io.ReadCloser, error) {
+	if item.Locked || m.aead == nil {
+		return nil, ErrNoKey
+	}
+	f, err := os.Open(item.TrashPath)
+	if err != nil {
+		return nil, wrapNotExist(err)
+	}
+	sr, err := m.newSealReader(f, filepath.Base(item.TrashPath))
+	if err == nil {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(sr); err == nil {
+			return gzipReadCloser{Reader: zr, file: f}, nil
+		}
+	}
+	f.Close()
+	return nil, err
+}
+
+// openSealedFile opens the content of a sealed file
+func (m *Manager) openSealedFile(item Item) (io.ReadCloser, error) {
+	r, err := m.openSealedItem(item)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		r.Close()
+		return nil, fmt.Errorf("%s is not a regular file", filepath.Base(item.TrashPath))
+	}
+	return &tarFile{Reader: tr, info: hdr.FileInfo(), closer: r}, nil
+}
+
+// sealedFS returns a read-only view of a sealed directory
+func (m *Manager) sealedFS(item Item) (fs.FS, error) {
+	return newTarFS(func() (io.ReadCloser, error) { return m.openSealedItem(item) })
+}
+
+// sealWriter encrypts a stream in chunks. Each chunk's nonce is a random
+// prefix and a counter, and its additional data names the item and marks
+// the last chunk, so chunks can be neither reordered, moved to another
+// item nor cut off.
+type sealWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	name  string
+	buf   []byte
+}
+
+func (m *Manager) newSealWriter(w io.Writer, trashName string) (*sealWriter, error) {
+	s := &sealWriter{w: w, aead: m.aead, nonce: make([]byte, m.aead.NonceSize()), name: trashName}
+	rand.Read(s.nonce[:len(s.nonce)-4])
+	if _, err := io.WriteString(w, sealMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(s.nonce[:len(s.nonce)-4]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	// A full chunk is held back until more follows, so Close always has a
+	// last chunk to mark
+	for len(s.buf) > sealChunk {
+		if err := s.flush(s.buf[:sealChunk], false); err != nil {
+			return 0, err
+		}
+		s.buf = append(s.buf[:0], s.buf[sealChunk:]...)
+	}
+	return len(p), nil
+}
+
+// Close writes the last chunk
+func (s *sealWriter) Close() error {
+	return s.flush(s.buf, true)
+}
+
+func (s *sealWriter) flush(chunk []byte, last bool) error {
+	if _, err := s.w.Write(s.aead.Seal(nil, s.nonce, chunk, chunkAD(s.name, last))); err != nil {
+		return err
+	}
+	return nextNonce(s.nonce)
+}
+
+// sealReader decrypts what sealWriter wrote
+type sealReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	name  string
+	buf   []byte
+	done  bool
+}
+
+func (m *Manager) newSealReader(r io.Reader, trashName string) (*sealReader, error) {
+	s := &sealReader{r: bufio.NewReader(r), aead: m.aead, nonce: make([]byte, m.aead.NonceSize()), name: trashName}
+	header := make([]byte, len(sealMagic)+len(s.nonce)-4)
+	if _, err := io.ReadFull(s.r, header); err != nil || !bytes.HasPrefix(header, []byte(sealMagic)) {
+		return nil, errors.New("not a sealed item")
+	}
+	copy(s.nonce, header[len(sealMagic):])
+	return s, nil
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk. The last one is shorter than a full chunk
+// or followed by the end of the file.
+func (s *sealReader) next() error {
+	chunk := make([]byte, sealChunk+s.aead.Overhead())
+	n, err := io.ReadFull(s.r, chunk)
+	switch {
+	case err == io.EOF:
+		return errors.New("sealed item is truncated")
+	case err == io.ErrUnexpectedEOF:
+		s.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := s.r.Peek(1); err == io.EOF {
+			s.done = true
+		}
+	}
+
+	plain, err := s.aead.Open(chunk[:0], s.nonce, chunk[:n], chunkAD(s.name, s.done))
+	if err != nil {
+		return errors.New("sealed item is damaged")
+	}
+	s.buf = plain
+	return nextNonce(s.nonce)
+}
+
+func chunkAD(name string, last bool) []byte {
+	ad := []byte("files/" + name + "\x00")
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// nextNonce counts up the last four bytes of a chunk nonce
+func nextNonce(nonce []byte) error {
+	counter := nonce[len(nonce)-4:]
+	n := binary.BigEndian.Uint32(counter) + 1
+	if n == 0 {
+		return errors.New("item too large to seal")
+	}
+	binary.BigEndian.PutUint32(counter, n)
+	return nil
+}
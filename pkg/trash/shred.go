@@ -0,0 +1,225 @@
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ShredOptions controls how items are destroyed by Shred
+type ShredOptions struct {
+	Passes   int                     `json:"passes"`           // Times each file is overwritten; at least once
+	Random   bool                    `json:"random,omitempty"` // Overwrite with random data instead of zeros
+	Progress func(done, total int64) `json:"-"`                // Called as bytes are overwritten, if set
+}
+
+// shredBlock is how much is overwritten per write
+const shredBlock = 1 << 20
+
+// shredder tracks the progress of one shred run across items
+type shredder struct {
+	ShredOptions
+	done, total int64
+}
+
+// Shred permanently deletes an item like Remove, but first overwrites its
+// files and metadata in place and renames every entry to a random name, so
+// that neither content nor names are left behind in the trash. Files whose
+// content other items still share through the blob store are only unlinked.
+// Overwriting in place cannot reach copies that SSDs and copy-on-write
+// filesystems keep elsewhere.
+func (m *Manager) Shred(trashName string, opts ShredOptions) error {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	if _, err := os.Stat(infoPath); err != nil {
+		return wrapNotExist(err)
+	}
+
+	return m.shredItems([]string{filepath.Join(m.filesDir, trashName)}, []string{infoPath}, opts)
+}
+
+// ShredAll empties the trash like Empty, shredding every item
+func (m *Manager) ShredAll(opts ShredOptions) error {
+	items, err := m.List()
+	if err != nil {
+		return err
+	}
+
+	var trashPaths, infoPaths []string
+	for _, item := range items {
+		trashName := filepath.Base(item.TrashPath)
+		trashPaths = append(trashPaths, filepath.Join(m.filesDir, trashName))
+		infoPaths = append(infoPaths, filepath.Join(m.infoDir, trashName+".json"))
+	}
+	if err := m.shredItems(trashPaths, infoPaths, opts); err != nil {
+		return err
+	}
+	// Whatever is left has no metadata, and no item to shred it as
+	return m.Empty()
+}
+
+// shredItems shreds the items at the given content and metadata paths,
+// reporting progress over all of them
+func (m *Manager) shredItems(trashPaths, infoPaths []string, opts ShredOptions) error {
+	s := &shredder{ShredOptions: opts}
+	for i := range trashPaths {
+		s.total += m.shredSize(trashPaths[i], infoPaths[i]) * int64(max(opts.Passes, 1))
+	}
+	for i := range trashPaths {
+		if err := m.shredItem(trashPaths[i], infoPaths[i], s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shredItem overwrites, renames and removes an item's files and metadata
+func (m *Manager) shredItem(trashPath, infoPath string, s *shredder) error {
+	// Metadata that cannot be read still lets the item go
+	item, _ := m.loadItemInfo(infoPath)
+	shared := sharedPaths(trashPath, item)
+
+	err := walkOwned(trashPath, shared, func(p string, info os.FileInfo) error {
+		return s.overwrite(p, info.Size())
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := scrub(trashPath); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(infoPath); err == nil {
+		if err := s.overwrite(infoPath, info.Size()); err != nil {
+			return err
+		}
+	}
+	if err := scrub(infoPath); err != nil {
+		return err
+	}
+	return m.release(item.Blobs)
+}
+
+// shredSize returns the bytes each pass over an item overwrites
+func (m *Manager) shredSize(trashPath, infoPath string) int64 {
+	item, _ := m.loadItemInfo(infoPath)
+
+	var size int64
+	walkOwned(trashPath, sharedPaths(trashPath, item), func(_ string, info os.FileInfo) error {
+		size += info.Size()
+		return nil
+	})
+	if info, err := os.Lstat(infoPath); err == nil {
+		size += info.Size()
+	}
+	return size
+}
+
+// sharedPaths returns the files under an item's trash path that link into
+// the blob store
+func sharedPaths(trashPath string, item Item) map[string]bool {
+	shared := map[string]bool{}
+	for _, blob := range item.Blobs {
+		if fs.ValidPath(blob.Path) {
+			shared[filepath.Join(trashPath, filepath.FromSlash(blob.Path))] = true
+		}
+	}
+	return shared
+}
+
+// walkOwned calls fn for every regular file under root whose content only
+// this item holds: its one link, or the blob's link besides its own when
+// no other item shares the blob
+func walkOwned(root string, shared map[string]bool, fn func(p string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if _, links, ok := inode(info); ok && links > 1 && !(shared[p] && links == 2) {
+			return nil
+		}
+		return fn(p, info)
+	})
+}
+
+// overwrite writes over the content of a file in place, syncing each pass
+// to disk
+func (s *shredder) overwrite(p string, size int64) error {
+	// Trashed files may be read-only
+	os.Chmod(p, 0600)
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, min(size, shredBlock))
+	for range max(s.Passes, 1) {
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+		for written := int64(0); written < size; {
+			n := min(size-written, int64(len(buf)))
+			if s.Random {
+				rand.Read(buf[:n])
+			} else {
+				clear(buf[:n])
+			}
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += n
+			s.done += n
+			if s.Progress != nil {
+				s.Progress(s.done, s.total)
+			}
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrub removes p and everything under it, renaming each entry to a random
+// name first so that the original names do not stay in the directory
+func scrub(p string) error {
+	info, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		// Directories must be writable to rename what they hold
+		os.Chmod(p, 0700)
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := scrub(filepath.Join(p, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	hidden := filepath.Join(filepath.Dir(p), randomName())
+	if err := os.Rename(p, hidden); err != nil {
+		return err
+	}
+	return os.Remove(hidden)
+}
+
+// randomName returns a name that says nothing about what it replaces
+func randomName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return ".rc-" + hex.EncodeToString(b)
+}
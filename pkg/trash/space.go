@@ -0,0 +1,43 @@
+package trash
+
+import "fmt"
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem holding dir; tests replace it
+var diskFree = statFree
+
+// FreeSpace returns the bytes left on the filesystem holding the trash. It
+// fails with errors.ErrUnsupported where that cannot be measured.
+func (m *Manager) FreeSpace() (int64, error) {
+	return diskFree(m.filesDir)
+}
+
+// SetFreeFloor makes the trash refuse to write copies of data, when
+// sealing, unsharing, compressing, unarchiving or moving items across
+// filesystems, that would leave less than floor bytes free; 0 turns it off
+func (m *Manager) SetFreeFloor(floor int64) {
+	m.floor = floor
+}
+
+// checkRoom returns ErrNoSpace if writing size bytes into the trash would
+// leave less than its floor free
+func (m *Manager) checkRoom(size int64) error {
+	return checkRoomIn(m.filesDir, size, m.floor)
+}
+
+// checkRoomIn returns ErrNoSpace if writing size bytes into dir would leave
+// less than floor free on its filesystem. Filesystems that cannot be
+// measured always have room.
+func checkRoomIn(dir string, size, floor int64) error {
+	if floor <= 0 {
+		return nil
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		return nil
+	}
+	if free-size < floor {
+		return fmt.Errorf("%w: %d bytes free, %d bytes to write", ErrNoSpace, free, size)
+	}
+	return nil
+}
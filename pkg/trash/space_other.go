@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package trash
+
+import "errors"
+
+// statFree cannot measure free space on this platform
+func statFree(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
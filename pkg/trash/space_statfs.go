@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package trash
+
+import "syscall"
+
+// statFree measures the free space of a filesystem with statfs
+func statFree(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -1,11 +1,15 @@
 package trash
 
 import (
+	"crypto/cipher"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
+
+	"github.com/cj3636/GoCycled/pkg/paths"
 )
 
 // Item represents a trashed item
@@ -14,47 +18,152 @@ type Item struct {
 	TrashPath    string    `json:"trash_path"`
 	DeletedAt    time.Time `json:"deleted_at"`
 	Size         int64     `json:"size"`
+	Batch        string    `json:"batch,omitempty"`
+	Git          *GitInfo  `json:"git,omitempty"`
+	Owner        *Owner    `json:"owner,omitempty"`
+	Compression  string    `json:"compression,omitempty"` // See CompressionGzip
+	StoredSize   int64     `json:"stored_size,omitempty"` // Bytes on disk when compressed; Size is the original size
+	Blobs        []Blob    `json:"blobs,omitempty"`       // Files shared through the blob store
+	Dir          bool      `json:"dir,omitempty"`         // A sealed item is a directory
+	Locked       bool      `json:"-"`                     // Sealed metadata read without the key
+	Note         string    `json:"note,omitempty"`        // Why the item was trashed, in the user's words
+	Tags         []string  `json:"tags,omitempty"`        // Labels to filter by, as in rc list --tag
+	Pinned       bool      `json:"pinned,omitempty"`      // Never purged by retention or size limits
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`   // Purged after this instead of after the bin's retention
+}
+
+// Expiry returns when the item is purged: its own expiry if it has one,
+// else retention after it was trashed. Pinned items, and items without an
+// expiry in a bin that keeps them forever, never expire.
+func (i Item) Expiry(retention time.Duration) (time.Time, bool) {
+	switch {
+	case i.Pinned:
+		return time.Time{}, false
+	case !i.ExpiresAt.IsZero():
+		return i.ExpiresAt, true
+	case retention > 0:
+		return i.DeletedAt.Add(retention), true
+	}
+	return time.Time{}, false
+}
+
+// HasTag reports whether the item carries tag
+func (i Item) HasTag(tag string) bool {
+	return slices.Contains(i.Tags, tag)
+}
+
+// Owner is the user and group that owned a file before it was trashed
+type Owner struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// GitInfo records where a trashed file lived in a git work tree, so it can
+// be rebuilt from the repository after the trash is emptied
+type GitInfo struct {
+	Root   string `json:"root"`             // Work tree root
+	Commit string `json:"commit,omitempty"` // HEAD when the file was trashed
+	Path   string `json:"path"`             // Path relative to Root
+	State  string `json:"state"`            // clean, modified, untracked or ignored
+}
+
+// String describes the work tree, commit and state, as in
+// "/src/app @ 1a2b3c4d5e6f (modified)"
+func (g *GitInfo) String() string {
+	commit := g.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "no commits"
+	}
+	return fmt.Sprintf("%s @ %s (%s)", g.Root, commit, g.State)
+}
+
+// PutOptions adds metadata to a trashed item
+type PutOptions struct {
+	Git       *GitInfo
+	Dedup     bool // Share the item's files with identical ones already trashed
+	Note      string
+	Tags      []string
+	ExpiresAt time.Time // Purge the item after this rather than after the bin's retention
 }
 
 // Manager handles trash operations
 type Manager struct {
-	trashDir string
-	filesDir string
-	infoDir  string
+	trashDir     string
+	filesDir     string
+	infoDir      string
+	blobsDir     string      // Content shared by identical files, by SHA-256
+	purgatoryDir string      // Deleted items held back for undo, see Drop
+	batch        string      // shared by every item this manager trashes
+	owner        *Owner      // owner of the directories and metadata it creates, if not the caller
+	aead         cipher.AEAD // key of an encrypted trash, once UseKey is given it
+	floor        int64       // free space that copies must leave, see SetFreeFloor
 }
 
 // NewManager creates a new trash manager
 func NewManager(trashDir string) (*Manager, error) {
+	return NewManagerAs(trashDir, nil)
+}
+
+// NewManagerAs creates a trash manager whose directories, metadata and
+// lock file belong to owner, such as the user who ran rc through sudo. The
+// trashed files themselves keep their owner.
+func NewManagerAs(trashDir string, owner *Owner) (*Manager, error) {
 	filesDir := filepath.Join(trashDir, "files")
 	infoDir := filepath.Join(trashDir, "info")
 
 	// Create trash directories if they don't exist
-	if err := os.MkdirAll(filesDir, 0755); err != nil {
+	if err := mkdirAs(filesDir, owner); err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(infoDir, 0755); err != nil {
+	if err := mkdirAs(infoDir, owner); err != nil {
 		return nil, err
 	}
 
 	return &Manager{
-		trashDir: trashDir,
-		filesDir: filesDir,
-		infoDir:  infoDir,
+		trashDir:     trashDir,
+		filesDir:     filesDir,
+		infoDir:      infoDir,
+		blobsDir:     filepath.Join(trashDir, "blobs"),
+		purgatoryDir: filepath.Join(trashDir, "purgatory"),
+		batch:        fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405"), os.Getpid()),
+		owner:        owner,
 	}, nil
 }
 
 // Put moves a file or directory to trash
 func (m *Manager) Put(path string) error {
+	_, err := m.PutWith(path, PutOptions{})
+	return err
+}
+
+// PutWith moves a file or directory to trash with extra metadata and returns
+// the new item
+func (m *Manager) PutWith(path string, opts PutOptions) (Item, error) {
 	// Get absolute path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return Item{}, err
+	}
+
+	if err := m.checkProtected(absPath); err != nil {
+		return Item{}, err
 	}
 
 	// Check if file exists
-	fileInfo, err := os.Stat(absPath)
+	fileInfo, err := os.Lstat(absPath)
 	if err != nil {
-		return err
+		return Item{}, wrapNotExist(err)
+	}
+
+	// An encrypted trash never takes a file unencrypted
+	if m.aead != nil {
+		return m.putSealed(absPath, fileInfo, opts)
+	}
+	if m.Encrypted() {
+		return Item{}, ErrNoKey
 	}
 
 	// Generate unique trash filename
@@ -77,7 +186,7 @@ func (m *Manager) Put(path string) error {
 
 	// Move file to trash
 	if err := os.Rename(absPath, trashPath); err != nil {
-		return err
+		return Item{}, wrapRename(err)
 	}
 
 	// Create info file
@@ -85,11 +194,20 @@ func (m *Manager) Put(path string) error {
 		OriginalPath: absPath,
 		TrashPath:    trashPath,
 		DeletedAt:    time.Now(),
-		Size:         getSize(fileInfo),
+		Size:         PathSize(trashPath, fileInfo),
+		Batch:        m.batch,
+		Git:          opts.Git,
+		Owner:        ownerOf(fileInfo),
+		Note:         opts.Note,
+		Tags:         opts.Tags,
+		ExpiresAt:    opts.ExpiresAt,
+	}
+	if opts.Dedup {
+		m.dedup(&item)
 	}
 
 	infoPath := filepath.Join(m.infoDir, trashName+".json")
-	return m.saveItemInfo(infoPath, item)
+	return item, m.saveItemInfo(infoPath, item)
 }
 
 // List returns all items in trash
@@ -124,7 +242,7 @@ func (m *Manager) Restore(trashName string) error {
 	// Load item info
 	item, err := m.loadItemInfo(infoPath)
 	if err != nil {
-		return err
+		return wrapNotExist(err)
 	}
 
 	// Check if original directory exists
@@ -136,12 +254,33 @@ func (m *Manager) Restore(trashName string) error {
 	}
 
 	// Check if original path exists
-	if _, err := os.Stat(item.OriginalPath); err == nil {
-		return fmt.Errorf("file already exists at original location: %s", item.OriginalPath)
+	if _, err := os.Lstat(item.OriginalPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrConflict, item.OriginalPath)
 	}
 
-	// Move file back
-	if err := os.Rename(trashPath, item.OriginalPath); err != nil {
+	// Move file back, decompressing it if needed. Shared files get their
+	// own copy first.
+	if err := m.unshare(&item); err != nil {
+		return err
+	}
+	if item.Compression == CompressionSealed {
+		if err := m.unsealTo(item, item.OriginalPath); err != nil {
+			return err
+		}
+		if err := os.Remove(trashPath); err != nil {
+			return err
+		}
+	} else if item.Compressed() {
+		if err := decompressTo(item, item.OriginalPath); err != nil {
+			return err
+		}
+		if err := os.Remove(trashPath); err != nil {
+			return err
+		}
+	} else if err := os.Rename(trashPath, item.OriginalPath); err != nil {
+		return wrapRename(err)
+	}
+	if err := restoreOwner(item.OriginalPath, item.Owner); err != nil {
 		return err
 	}
 
@@ -151,16 +290,59 @@ func (m *Manager) Restore(trashName string) error {
 
 // Remove permanently deletes an item from trash
 func (m *Manager) Remove(trashName string) error {
-	trashPath := filepath.Join(m.filesDir, trashName)
 	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	if _, err := os.Stat(infoPath); err != nil {
+		return wrapNotExist(err)
+	}
+	return m.deleteItem(filepath.Join(m.filesDir, trashName), infoPath)
+}
+
+// deleteItem deletes an item's content and metadata, then the blobs only
+// it used
+func (m *Manager) deleteItem(trashPath, infoPath string) error {
+	// Metadata that cannot be read still lets the item go
+	item, _ := m.loadItemInfo(infoPath)
 
 	// Remove file/directory
 	if err := os.RemoveAll(trashPath); err != nil {
 		return err
 	}
 
-	// Remove info file
-	return os.Remove(infoPath)
+	// Remove info file, then the blobs only this item used
+	if err := os.Remove(infoPath); err != nil {
+		return err
+	}
+	return m.release(item.Blobs)
+}
+
+// SetPinned pins an item, so that retention and size limits never purge
+// it, or unpins it
+func (m *Manager) SetPinned(trashName string, pinned bool) error {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	item, err := m.loadItemInfo(infoPath)
+	if err != nil {
+		return wrapNotExist(err)
+	}
+	if item.Locked {
+		return ErrNoKey
+	}
+	item.Pinned = pinned
+	return m.saveItemInfo(infoPath, item)
+}
+
+// SetExpiry sets when an item is purged; a zero time goes back to the
+// bin's retention
+func (m *Manager) SetExpiry(trashName string, at time.Time) error {
+	infoPath := filepath.Join(m.infoDir, trashName+".json")
+	item, err := m.loadItemInfo(infoPath)
+	if err != nil {
+		return wrapNotExist(err)
+	}
+	if item.Locked {
+		return ErrNoKey
+	}
+	item.ExpiresAt = at
+	return m.saveItemInfo(infoPath, item)
 }
 
 // Empty removes all items from trash
@@ -172,38 +354,123 @@ func (m *Manager) Empty() error {
 	if err := os.RemoveAll(m.infoDir); err != nil {
 		return err
 	}
+	if err := os.RemoveAll(m.blobsDir); err != nil {
+		return err
+	}
 
-	// Recreate directories
-	if err := os.MkdirAll(m.filesDir, 0755); err != nil {
+	// Recreate directories, owned like NewManagerAs makes them
+	if err := mkdirAs(m.filesDir, m.owner); err != nil {
 		return err
 	}
-	return os.MkdirAll(m.infoDir, 0755)
+	return mkdirAs(m.infoDir, m.owner)
 }
 
-// Size returns the total size of trash in bytes
+// Size returns the total size of trash in bytes. Files shared by hardlink
+// count once.
 func (m *Manager) Size() (int64, error) {
 	var totalSize int64
-
-	err := filepath.Walk(m.filesDir, func(path string, info os.FileInfo, err error) error {
+	seen := map[fileID]bool{}
+
+	for _, dir := range []string{m.filesDir, m.blobsDir} {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path == m.blobsDir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if id, links, ok := inode(info); ok && links > 1 {
+				if seen[id] {
+					return nil
+				}
+				seen[id] = true
+			}
+			totalSize += info.Size()
+			return nil
+		})
 		if err != nil {
-			return err
+			return totalSize, err
 		}
-		if !info.IsDir() {
-			totalSize += info.Size()
+	}
+	return totalSize, nil
+}
+
+// Usage returns the logical size of the trashed items, as they were before
+// compression and deduplication, and the bytes they take up on disk
+func (m *Manager) Usage() (logical, stored int64, err error) {
+	items, err := m.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, item := range items {
+		logical += item.Size
+	}
+	stored, err = m.Size()
+	return logical, stored, err
+}
+
+// Delete permanently deletes a file or directory without trashing it, for
+// files that are not worth keeping. Like Put, it refuses the paths that
+// must never be trashed.
+func (m *Manager) Delete(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := m.checkProtected(absPath); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(absPath); err != nil {
+		return wrapNotExist(err)
+	}
+	return os.RemoveAll(absPath)
+}
+
+// checkProtected returns ErrProtected for paths that must never be trashed:
+// the filesystem root, the home directory and the trash storage itself
+func (m *Manager) checkProtected(absPath string) error {
+	protected := []string{"/", m.trashDir, m.filesDir, m.infoDir, m.blobsDir, m.purgatoryDir}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, homeDir)
+	}
+	for _, p := range protected {
+		if p, err := filepath.Abs(p); err == nil && absPath == p {
+			return fmt.Errorf("%w: %s", ErrProtected, absPath)
 		}
-		return nil
-	})
+	}
 
-	return totalSize, err
+	// Nothing inside the storage directories may be trashed again
+	for _, dir := range []string{m.filesDir, m.infoDir, m.blobsDir, m.purgatoryDir} {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if paths.Within(dir, absPath) {
+			return fmt.Errorf("%w: %s", ErrProtected, absPath)
+		}
+	}
+	return nil
 }
 
-// saveItemInfo saves item info to a JSON file
+// saveItemInfo saves item info to a JSON file, sealed for sealed items
 func (m *Manager) saveItemInfo(path string, item Item) error {
-	data, err := json.MarshalIndent(item, "", "  ")
+	var data []byte
+	var err error
+	if item.Compression == CompressionSealed {
+		data, err = m.sealInfo(item)
+	} else {
+		data, err = json.MarshalIndent(item, "", "  ")
+	}
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return m.chown(path)
 }
 
 // loadItemInfo loads item info from a JSON file
@@ -213,15 +480,36 @@ func (m *Manager) loadItemInfo(path string) (Item, error) {
 		return Item{}, err
 	}
 
-	var item Item
-	if err := json.Unmarshal(data, &item); err != nil {
+	var info struct {
+		Item
+		sealedInfo
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
 		return Item{}, err
 	}
+	if info.Sealed != nil {
+		return m.openInfo(path, info.Sealed)
+	}
 
-	return item, nil
+	return info.Item, nil
 }
 
-// getSize returns the size of a file or directory
-func getSize(info os.FileInfo) int64 {
-	return info.Size()
+// PathSize returns the size of a file, or the total size of the files in a
+// directory, as trashing it records
+func PathSize(path string, info os.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+
+	var total int64
+	filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			total += fi.Size()
+		}
+		return nil
+	})
+	return total
 }
@@ -1,10 +1,18 @@
 package trash
 
 import (
+	"archive/tar"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewManager(t *testing.T) {
@@ -216,3 +224,1336 @@ func TestSize(t *testing.T) {
 		t.Error("Size should not be 0")
 	}
 }
+
+func TestSentinelErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, err := NewManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	// Missing file
+	if err := mgr.Put(filepath.Join(tempDir, "missing.txt")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Missing trash item
+	if err := mgr.Restore("missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Restore, got %v", err)
+	}
+	if err := mgr.Remove("missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Remove, got %v", err)
+	}
+
+	// Protected paths, whether trashed or deleted outright as clean git
+	// files and rules do
+	home := filepath.Join(tempDir, "home")
+	os.Mkdir(home, 0755)
+	t.Setenv("HOME", home)
+	for _, path := range []string{"/", tempDir, mgr.filesDir, mgr.infoDir, home} {
+		if err := mgr.Put(path); !errors.Is(err, ErrProtected) {
+			t.Errorf("Expected ErrProtected for %s, got %v", path, err)
+		}
+		if err := mgr.Delete(path); !errors.Is(err, ErrProtected) {
+			t.Errorf("Expected ErrProtected deleting %s, got %v", path, err)
+		}
+	}
+	if _, err := os.Stat(home); err != nil {
+		t.Errorf("Protected home was deleted: %v", err)
+	}
+
+	// Restore conflict
+	testFile := filepath.Join(tempDir, "conflict.txt")
+	if err := os.WriteFile(testFile, []byte("v1"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := mgr.Put(testFile); err != nil {
+		t.Fatalf("Failed to put file in trash: %v", err)
+	}
+	if err := os.WriteFile(testFile, []byte("v2"), 0644); err != nil {
+		t.Fatalf("Failed to recreate test file: %v", err)
+	}
+	items, _ := mgr.List()
+	if len(items) == 0 {
+		t.Fatal("No items in trash")
+	}
+	if err := mgr.Restore(filepath.Base(items[0].TrashPath)); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	mgr, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	unlock, err := mgr.Lock()
+	if err != nil {
+		t.Fatalf("Failed to lock trash: %v", err)
+	}
+
+	// A second lock on the same trash must fail while the first is held
+	if _, err := mgr.Lock(); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+
+	unlock()
+	unlock2, err := mgr.Lock()
+	if err != nil {
+		t.Fatalf("Failed to lock trash after unlock: %v", err)
+	}
+	unlock2()
+}
+
+func TestOpenAndExtract(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, err := NewManager(filepath.Join(tempDir, "trash"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	// Create and trash a directory
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(projectDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "src", "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := mgr.Put(projectDir); err != nil {
+		t.Fatalf("Failed to put directory in trash: %v", err)
+	}
+
+	items, _ := mgr.List()
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+	trashName := filepath.Base(items[0].TrashPath)
+
+	if items[0].Size != int64(len("package main")) {
+		t.Errorf("Directory size should include its files, got %d", items[0].Size)
+	}
+
+	// Read a file inside the trashed directory
+	r, err := mgr.Open(trashName, "src/main.go")
+	if err != nil {
+		t.Fatalf("Failed to open file in trash: %v", err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if string(content) != "package main" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+
+	if _, err := mgr.Open(trashName, "../escape"); err == nil {
+		t.Error("Open should reject paths outside the item")
+	}
+	if _, err := mgr.Open(trashName, "missing.go"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Extract a copy and leave the item in the trash
+	if err := mgr.Extract(trashName, "src/main.go", tempDir); err != nil {
+		t.Fatalf("Failed to extract file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "main.go")); err != nil {
+		t.Error("Extracted file should exist")
+	}
+	if err := mgr.Extract(trashName, "src/main.go", tempDir); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict when extracting over a file, got %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 1 {
+		t.Error("Item should stay in trash after extract")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, err := NewManager(filepath.Join(tempDir, "trash"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	// Three items of 100 bytes, trashed 10, 5 and 1 days ago
+	now := time.Now()
+	for i, age := range []int{10, 5, 1} {
+		path := filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put file: %v", err)
+		}
+		setDeletedAt(t, mgr, path, now.Add(-time.Duration(age)*24*time.Hour))
+	}
+
+	// Items from this manager's own batch are safe from size eviction, so
+	// purge as a later run would
+	other, _ := NewManager(mgr.trashDir)
+	other.batch = "later-run"
+
+	purged, err := other.Purge(Policy{MaxAge: 7 * 24 * time.Hour}, now)
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "file0.txt" {
+		t.Fatalf("Expected only the 10 day old item to expire, got %v", purged)
+	}
+
+	purged, err = other.Purge(Policy{MaxSize: 150}, now)
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "file1.txt" {
+		t.Fatalf("Expected the oldest item to be evicted, got %v", purged)
+	}
+
+	// A larger, newer item goes first when evicting the largest
+	big := filepath.Join(tempDir, "big.txt")
+	os.WriteFile(big, make([]byte, 300), 0644)
+	if err := mgr.Put(big); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	purged, err = other.Purge(Policy{MaxSize: 150, Largest: true}, now)
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "big.txt" {
+		t.Fatalf("Expected the largest item to be evicted, got %v", purged)
+	}
+
+	if purged, _ := mgr.Purge(Policy{MaxSize: 1}, now); len(purged) != 0 {
+		t.Errorf("Items from the current batch should not be evicted, got %v", purged)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	tempDir := t.TempDir()
+	src, _ := NewManager(filepath.Join(tempDir, "src"))
+	dest, _ := NewManager(filepath.Join(tempDir, "dest"))
+
+	testDir := filepath.Join(tempDir, "project")
+	os.MkdirAll(filepath.Join(testDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(testDir, "sub", "a.txt"), []byte("a"), 0644)
+	if err := src.Put(testDir); err != nil {
+		t.Fatalf("Failed to put dir: %v", err)
+	}
+
+	items, _ := src.List()
+	moved, err := src.MoveTo(filepath.Base(items[0].TrashPath), dest)
+	if err != nil {
+		t.Fatalf("Failed to move item: %v", err)
+	}
+	if moved.OriginalPath != testDir || filepath.Dir(moved.TrashPath) != dest.filesDir {
+		t.Errorf("Unexpected moved item: %+v", moved)
+	}
+
+	if items, _ := src.List(); len(items) != 0 {
+		t.Errorf("Source should be empty, has %d items", len(items))
+	}
+	if err := dest.Restore(filepath.Base(moved.TrashPath)); err != nil {
+		t.Fatalf("Failed to restore moved item: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(testDir, "sub", "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("Restored content mismatch: %q, %v", data, err)
+	}
+
+	if _, err := src.MoveTo("missing", dest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	os.MkdirAll(filepath.Join(src, "dir"), 0750)
+	os.WriteFile(filepath.Join(src, "dir", "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("dir/run.sh", filepath.Join(src, "link"))
+
+	dst := filepath.Join(tempDir, "dst")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "dir", "run.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("File mode not kept: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "dir/run.sh" {
+		t.Errorf("Symlink not kept: %q, %v", target, err)
+	}
+}
+
+// setDeletedAt rewrites the deletion time of the item trashed from path
+func TestOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file owners requires root")
+	}
+	tempDir := t.TempDir()
+	owner := &Owner{UID: 1234, GID: 5678}
+	mgr, err := NewManagerAs(filepath.Join(tempDir, "home", "trash"), owner)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	// Directories and metadata belong to the owner, not the caller
+	for _, path := range []string{filepath.Join(tempDir, "home"), mgr.trashDir, mgr.filesDir, mgr.infoDir} {
+		info, _ := os.Stat(path)
+		if got := ownerOf(info); *got != *owner {
+			t.Errorf("%s owned by %+v, want %+v", path, got, owner)
+		}
+	}
+
+	testFile := filepath.Join(tempDir, "system.conf")
+	os.WriteFile(testFile, []byte("x"), 0644)
+	os.Lchown(testFile, 42, 43)
+	item, err := mgr.PutWith(testFile, PutOptions{})
+	if err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if item.Owner == nil || *item.Owner != (Owner{UID: 42, GID: 43}) {
+		t.Errorf("Recorded owner = %+v, want 42:43", item.Owner)
+	}
+	info, _ := os.Stat(filepath.Join(mgr.infoDir, filepath.Base(item.TrashPath)+".json"))
+	if got := ownerOf(info); *got != *owner {
+		t.Errorf("Item info owned by %+v, want %+v", got, owner)
+	}
+
+	// A copy made while trashing would belong to root; restore fixes it
+	os.Lchown(item.TrashPath, 0, 0)
+	if err := mgr.Restore(filepath.Base(item.TrashPath)); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	info, _ = os.Lstat(testFile)
+	if got := ownerOf(info); *got != (Owner{UID: 42, GID: 43}) {
+		t.Errorf("Restored file owned by %+v, want 42:43", got)
+	}
+
+	// Emptying recreates the directories for the owner too
+	if err := mgr.Empty(); err != nil {
+		t.Fatalf("Failed to empty: %v", err)
+	}
+	for _, path := range []string{mgr.filesDir, mgr.infoDir} {
+		info, _ := os.Stat(path)
+		if got := ownerOf(info); *got != *owner {
+			t.Errorf("%s owned by %+v after empty, want %+v", path, got, owner)
+		}
+	}
+}
+
+func TestImportFreedesktop(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "rc"))
+
+	// A per-volume trash, whose paths are relative to the volume
+	foreign := filepath.Join(tempDir, "vol", ".Trash-1000")
+	os.MkdirAll(filepath.Join(foreign, "files"), 0700)
+	os.MkdirAll(filepath.Join(foreign, "info"), 0700)
+	writeForeign := func(name, info string) {
+		os.WriteFile(filepath.Join(foreign, "files", name), []byte(name), 0644)
+		if info != "" {
+			os.WriteFile(filepath.Join(foreign, "info", name+".trashinfo"), []byte(info), 0600)
+		}
+	}
+	writeForeign("a b.txt", "[Trash Info]\nPath=/home/user/a%20b.txt\nDeletionDate=2024-03-01T10:20:30\n")
+	writeForeign("rel.txt", "[Trash Info]\nPath=docs/rel.txt\nDeletionDate=2024-03-02T08:00:00\n")
+	writeForeign("bad.txt", "[Trash Info]\nPath=/home/user/bad.txt\nDeletionDate=yesterday\n")
+	writeForeign("orphan.txt", "")
+
+	results, err := mgr.Import(foreign, Freedesktop, true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 0 {
+		t.Errorf("Dry run imported %d items", len(items))
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %+v", results)
+	}
+
+	results, err = mgr.Import(foreign, Freedesktop, false)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	failed := map[string]bool{}
+	for _, r := range results {
+		if r.Err != nil {
+			failed[filepath.Base(r.Source)] = true
+		}
+	}
+	if len(failed) != 2 || !failed["bad.txt.trashinfo"] || !failed["orphan.txt"] {
+		t.Errorf("Expected bad.txt and orphan.txt to fail, got %v", failed)
+	}
+
+	items, _ := mgr.List()
+	paths := map[string]time.Time{}
+	for _, item := range items {
+		paths[item.OriginalPath] = item.DeletedAt
+	}
+	want := map[string]time.Time{
+		"/home/user/a b.txt":                       time.Date(2024, 3, 1, 10, 20, 30, 0, time.Local),
+		filepath.Join(tempDir, "vol/docs/rel.txt"): time.Date(2024, 3, 2, 8, 0, 0, 0, time.Local),
+	}
+	for path, at := range want {
+		if got, ok := paths[path]; !ok || !got.Equal(at) {
+			t.Errorf("Item %s deleted at %v, want %v (items: %v)", path, got, at, paths)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(foreign, "info", "rel.txt.trashinfo")); !os.IsNotExist(err) {
+		t.Errorf("Imported trashinfo should be removed, got %v", err)
+	}
+
+	// Importing the same items again finds them already there
+	writeForeign("again.txt", "[Trash Info]\nPath=/home/user/a%20b.txt\nDeletionDate=2024-03-01T10:20:30\n")
+	results, _ = mgr.Import(foreign, Freedesktop, false)
+	duplicates := 0
+	for _, r := range results {
+		if errors.Is(r.Err, ErrDuplicate) {
+			duplicates++
+		}
+	}
+	if duplicates != 1 {
+		t.Errorf("Expected 1 duplicate, got %+v", results)
+	}
+
+	if _, err := mgr.Import(filepath.Join(tempDir, "missing"), TrashCLI, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing trash, got %v", err)
+	}
+}
+
+func TestExportAndImportJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	src, _ := NewManager(filepath.Join(tempDir, "src"))
+	testFile := filepath.Join(tempDir, "notes 100%.txt")
+	os.WriteFile(testFile, []byte("notes"), 0644)
+	item, err := src.PutWith(testFile, PutOptions{})
+	if err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	foreign := filepath.Join(tempDir, "Trash")
+	if results, err := src.Export(foreign, Freedesktop, false); err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Export failed: %+v, %v", results, err)
+	}
+	if items, _ := src.List(); len(items) != 0 {
+		t.Errorf("Exported items should leave the trash, %d left", len(items))
+	}
+	info, err := os.ReadFile(filepath.Join(foreign, "info", filepath.Base(item.TrashPath)+".trashinfo"))
+	if err != nil {
+		t.Fatalf("Missing trashinfo: %v", err)
+	}
+	if !strings.Contains(string(info), "notes%20100%25.txt") {
+		t.Errorf("Path not escaped in trashinfo:\n%s", info)
+	}
+
+	// Round trip back through the freedesktop reader
+	dest, _ := NewManager(filepath.Join(tempDir, "dest"))
+	if _, err := dest.Import(foreign, Freedesktop, false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	items, _ := dest.List()
+	if len(items) != 1 || items[0].OriginalPath != testFile || items[0].DeletedAt.Unix() != item.DeletedAt.Unix() {
+		t.Fatalf("Round trip changed the item: %+v", items)
+	}
+	if err := dest.Restore(filepath.Base(items[0].TrashPath)); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	// An rc trash from elsewhere keeps all its metadata
+	other, _ := NewManager(filepath.Join(tempDir, "other"))
+	other.PutWith(testFile, PutOptions{Git: &GitInfo{Root: tempDir, Path: "notes", State: "clean"}})
+	results, err := dest.Import(filepath.Join(tempDir, "other"), JSON, false)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("JSON import failed: %+v, %v", results, err)
+	}
+	items, _ = dest.List()
+	if len(items) != 1 || items[0].Git == nil || filepath.Dir(items[0].TrashPath) != dest.filesDir {
+		t.Errorf("JSON import lost metadata: %+v", items)
+	}
+
+	// Metadata cannot point an import at files outside the trash
+	victim := filepath.Join(tempDir, "victim")
+	os.WriteFile(victim, []byte("mine"), 0644)
+	evil := filepath.Join(tempDir, "evil")
+	os.MkdirAll(filepath.Join(evil, "files"), 0755)
+	os.MkdirAll(filepath.Join(evil, "info"), 0755)
+	os.WriteFile(filepath.Join(evil, "info", "evil.json"), []byte(`{"original_path": "/tmp/x", "trash_path": "`+victim+`"}`), 0644)
+	results, err = dest.Import(evil, JSON, false)
+	if err != nil || len(results) != 1 || results[0].Err == nil {
+		t.Errorf("Expected the outside trash_path to fail, got %+v, %v", results, err)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("The outside file must stay: %v", err)
+	}
+
+	// Deduplicated files leave the other trash's blob store behind
+	shared, _ := NewManager(filepath.Join(tempDir, "shared"))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, bytes.Repeat([]byte("same"), dedupMinSize), 0644)
+		if _, err := shared.PutWith(path, PutOptions{Dedup: true}); err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+	}
+	if items, _ := shared.List(); len(items) != 2 || len(items[0].Blobs) != 1 {
+		t.Skip("Hardlinks are not supported here")
+	}
+	fresh, _ := NewManager(filepath.Join(tempDir, "fresh"))
+	if results, err := fresh.Import(shared.trashDir, JSON, false); err != nil || len(results) != 2 {
+		t.Fatalf("JSON import failed: %+v, %v", results, err)
+	}
+	items, _ = fresh.List()
+	for _, item := range items {
+		info, err := os.Lstat(item.TrashPath)
+		if err != nil {
+			t.Fatalf("Missing imported file: %v", err)
+		}
+		if _, links, ok := inode(info); len(item.Blobs) != 0 || ok && links != 1 {
+			t.Errorf("Imported item still shares content: %d links, blobs %v", links, item.Blobs)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	src, _ := NewManager(filepath.Join(tempDir, "src"))
+
+	project := filepath.Join(tempDir, "project")
+	os.MkdirAll(filepath.Join(project, "bin"), 0755)
+	os.WriteFile(filepath.Join(project, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0750)
+	os.Symlink("bin/run.sh", filepath.Join(project, "run"))
+	notes := filepath.Join(tempDir, "notes.txt")
+	os.WriteFile(notes, []byte("notes"), 0600)
+	for _, path := range []string{project, notes} {
+		if err := src.Put(path); err != nil {
+			t.Fatalf("Failed to put %s: %v", path, err)
+		}
+	}
+
+	items, _ := src.List()
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = filepath.Base(item.TrashPath)
+	}
+	var buf bytes.Buffer
+	if err := src.Archive(&buf, names); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	archive := buf.Bytes()
+
+	dest, _ := NewManager(filepath.Join(tempDir, "dest"))
+	results, err := dest.Unarchive(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Unarchive failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("Failed to unarchive %s: %v", r.Source, r.Err)
+		}
+	}
+
+	restored, _ := dest.List()
+	if len(restored) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(restored))
+	}
+	for _, item := range restored {
+		for _, orig := range items {
+			if orig.OriginalPath == item.OriginalPath && !orig.DeletedAt.Equal(item.DeletedAt) {
+				t.Errorf("%s: deletion time %v, want %v", item.OriginalPath, item.DeletedAt, orig.DeletedAt)
+			}
+		}
+		if err := dest.Restore(filepath.Base(item.TrashPath)); err != nil {
+			t.Fatalf("Failed to restore %s: %v", item.OriginalPath, err)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(project, "bin", "run.sh")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Mode not kept: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(project, "run")); err != nil || target != "bin/run.sh" {
+		t.Errorf("Symlink not kept: %q, %v", target, err)
+	}
+	if data, err := os.ReadFile(notes); err != nil || string(data) != "notes" {
+		t.Errorf("Content not kept: %q, %v", data, err)
+	}
+
+	// Loading the archive again into a trash that has the items skips them
+	other, _ := NewManager(filepath.Join(tempDir, "other"))
+	other.Unarchive(bytes.NewReader(archive))
+	results, _ = other.Unarchive(bytes.NewReader(archive))
+	for _, r := range results {
+		if !errors.Is(r.Err, ErrDuplicate) {
+			t.Errorf("Expected ErrDuplicate for %s, got %v", r.OriginalPath, r.Err)
+		}
+	}
+}
+
+func TestUnarchiveRejectsEscapes(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeEntry := func(hdr *tar.Header, data string) {
+		hdr.Size = int64(len(data))
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		hdr.Mode = 0644
+		tw.WriteHeader(hdr)
+		tw.Write([]byte(data))
+	}
+	writeEntry(&tar.Header{Name: "info/evil.json"}, `{"original_path": "/tmp/evil", "deleted_at": "2024-01-01T00:00:00Z"}`)
+	writeEntry(&tar.Header{Name: "files/evil/", Typeflag: tar.TypeDir}, "")
+	writeEntry(&tar.Header{Name: "files/evil/out", Typeflag: tar.TypeSymlink, Linkname: tempDir}, "")
+	writeEntry(&tar.Header{Name: "files/evil/out/pwned"}, "x")
+	writeEntry(&tar.Header{Name: "../escape"}, "x")
+	tw.Close()
+
+	results, err := mgr.Unarchive(&buf)
+	if err != nil {
+		t.Fatalf("Unarchive failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("Expected %s to be rejected", r.Source)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "pwned")); !os.IsNotExist(err) {
+		t.Errorf("Archive wrote through a symlink: %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 0 {
+		t.Errorf("Expected nothing unarchived, got %+v", items)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	logText := strings.Repeat("GET /index.html 200\n", 1000)
+	logFile := filepath.Join(tempDir, "access.log")
+	os.WriteFile(logFile, []byte(logText), 0640)
+	build := filepath.Join(tempDir, "build")
+	os.MkdirAll(filepath.Join(build, "obj"), 0750)
+	os.WriteFile(filepath.Join(build, "obj", "main.o"), []byte(logText), 0644)
+	os.Symlink("obj/main.o", filepath.Join(build, "latest"))
+	small := filepath.Join(tempDir, "small.txt")
+	os.WriteFile(small, []byte("small"), 0644)
+	for _, path := range []string{logFile, build, small} {
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put %s: %v", path, err)
+		}
+	}
+
+	policy := CompressPolicy{MinAge: 24 * time.Hour, MinSize: 1000}
+	if compressed, _ := mgr.Compress(policy, time.Now()); len(compressed) != 0 {
+		t.Errorf("Fresh items should not be compressed: %+v", compressed)
+	}
+	compressed, err := mgr.Compress(policy, time.Now().Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if len(compressed) != 2 {
+		t.Fatalf("Expected 2 compressed items, got %+v", compressed)
+	}
+
+	items, _ := mgr.List()
+	byPath := map[string]Item{}
+	for _, item := range items {
+		byPath[item.OriginalPath] = item
+	}
+	logItem, buildItem := byPath[logFile], byPath[build]
+	if logItem.Compression != CompressionGzip || logItem.Size != int64(len(logText)) || logItem.StoredSize >= logItem.Size {
+		t.Errorf("Unexpected file item: %+v", logItem)
+	}
+	if buildItem.Compression != CompressionTarGzip || !buildItem.IsDir() {
+		t.Errorf("Unexpected directory item: %+v", buildItem)
+	}
+	if byPath[small].Compression != "" {
+		t.Errorf("Small item should be left alone: %+v", byPath[small])
+	}
+	if _, stored, _ := mgr.Usage(); stored >= int64(2*len(logText)) {
+		t.Errorf("Stored size %d did not shrink", stored)
+	}
+
+	// Reading compressed items
+	r, err := mgr.Open(filepath.Base(logItem.TrashPath), "")
+	if err != nil {
+		t.Fatalf("Failed to open compressed file: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != logText {
+		t.Errorf("Compressed file content mismatch")
+	}
+	fsys, err := mgr.ItemFS(filepath.Base(buildItem.TrashPath))
+	if err != nil {
+		t.Fatalf("Failed to open compressed directory: %v", err)
+	}
+	if _, err := mgr.ItemFS(filepath.Base(logItem.TrashPath)); !errors.Is(err, ErrNotDir) {
+		t.Errorf("Expected ErrNotDir for a compressed file, got %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "obj/main.o"); err != nil || string(data) != logText {
+		t.Errorf("Compressed directory content mismatch: %v", err)
+	}
+	if entries, err := fs.ReadDir(fsys, "."); err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries in compressed directory, got %v, %v", entries, err)
+	}
+
+	// Restoring decompresses
+	for _, item := range []Item{logItem, buildItem} {
+		if err := mgr.Restore(filepath.Base(item.TrashPath)); err != nil {
+			t.Fatalf("Failed to restore %s: %v", item.OriginalPath, err)
+		}
+	}
+	if info, err := os.Stat(logFile); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Restored file mode not kept: %v, %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(build, "obj")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Restored directory mode not kept: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(build, "latest")); err != nil || target != "obj/main.o" {
+		t.Errorf("Restored symlink mismatch: %q, %v", target, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(build, "obj", "main.o")); string(data) != logText {
+		t.Errorf("Restored content mismatch")
+	}
+}
+
+func TestCompressSkipsIncompressible(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	// Random bytes, like an already compressed photo
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	path := filepath.Join(tempDir, "photo.jpg")
+	os.WriteFile(path, random, 0644)
+	mgr.Put(path)
+
+	policy := CompressPolicy{MinAge: time.Hour}
+	compressed, err := mgr.Compress(policy, time.Now().Add(2*time.Hour))
+	if err != nil || len(compressed) != 0 {
+		t.Fatalf("Expected nothing compressed, got %+v, %v", compressed, err)
+	}
+	items, _ := mgr.List()
+	if items[0].Compression != CompressionNone {
+		t.Errorf("Incompressible item should be marked, got %q", items[0].Compression)
+	}
+}
+
+func setDeletedAt(t *testing.T, mgr *Manager, path string, at time.Time) {
+	t.Helper()
+	items, err := mgr.List()
+	if err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	for _, item := range items {
+		if item.OriginalPath == path {
+			item.DeletedAt = at
+			infoPath := filepath.Join(mgr.infoDir, filepath.Base(item.TrashPath)+".json")
+			if err := mgr.saveItemInfo(infoPath, item); err != nil {
+				t.Fatalf("Failed to save item info: %v", err)
+			}
+			return
+		}
+	}
+	t.Fatalf("No item for %s", path)
+}
+
+func TestDedup(t *testing.T) {
+	if !hardlinks {
+		t.Skip("hardlinks are not counted on this platform")
+	}
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	content := strings.Repeat("vendored library code\n", 500)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var paths []string
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tempDir, name, "vendor")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "lib.go"), []byte(content), 0644)
+		os.WriteFile(filepath.Join(dir, "tiny.go"), []byte("package lib"), 0644)
+		paths = append(paths, filepath.Join(tempDir, name))
+	}
+	os.Chtimes(filepath.Join(paths[1], "vendor", "lib.go"), old, old)
+
+	var items []Item
+	for _, path := range paths {
+		item, err := mgr.PutWith(path, PutOptions{Dedup: true})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", path, err)
+		}
+		if len(item.Blobs) != 1 || item.Blobs[0].Path != "vendor/lib.go" {
+			t.Fatalf("Expected lib.go to be shared, got %+v", item.Blobs)
+		}
+		items = append(items, item)
+	}
+
+	a, _ := os.Stat(filepath.Join(items[0].TrashPath, "vendor", "lib.go"))
+	b, _ := os.Stat(filepath.Join(items[1].TrashPath, "vendor", "lib.go"))
+	if !os.SameFile(a, b) {
+		t.Error("Identical files should share one inode")
+	}
+	logical, stored, err := mgr.Usage()
+	if err != nil || logical != items[0].Size+items[1].Size || stored != logical-int64(len(content)) {
+		t.Errorf("Usage() = %d, %d, %v; content should count once", logical, stored, err)
+	}
+
+	// The blob outlives the first item and goes with the last
+	if err := mgr.Remove(filepath.Base(items[0].TrashPath)); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	blobPath := mgr.blobPath(items[1].Blobs[0].Hash)
+	if _, err := os.Stat(blobPath); err != nil {
+		t.Errorf("Blob still in use was removed: %v", err)
+	}
+
+	// A restored file is a copy of its own with its own time
+	if err := mgr.Restore(filepath.Base(items[1].TrashPath)); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored := filepath.Join(paths[1], "vendor", "lib.go")
+	info, err := os.Stat(restored)
+	if err != nil {
+		t.Fatalf("Restored file missing: %v", err)
+	}
+	if _, links, _ := inode(info); links != 1 {
+		t.Errorf("Restored file still has %d links", links)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("Restored time = %v, want %v", info.ModTime(), old)
+	}
+	if data, _ := os.ReadFile(restored); string(data) != content {
+		t.Error("Restored content mismatch")
+	}
+	if _, err := os.Stat(blobPath); !os.IsNotExist(err) {
+		t.Errorf("Unused blob was kept: %v", err)
+	}
+}
+
+func TestDedupLinkedFile(t *testing.T) {
+	if !hardlinks {
+		t.Skip("hardlinks are not counted on this platform")
+	}
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	// a keeps a hardlink outside the trash; b is a separate copy
+	content := strings.Repeat("shared content\n", 500)
+	a, b, live := filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b"), filepath.Join(tempDir, "live")
+	os.WriteFile(a, []byte(content), 0644)
+	os.Link(a, live)
+	os.WriteFile(b, []byte(content), 0644)
+
+	var items []Item
+	for _, path := range []string{a, b} {
+		item, err := mgr.PutWith(path, PutOptions{Dedup: true})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", path, err)
+		}
+		items = append(items, item)
+	}
+	if len(items[0].Blobs) != 0 {
+		t.Errorf("A file linked outside the trash should not be shared, got %+v", items[0].Blobs)
+	}
+
+	// Editing the outside link leaves b and the blob store alone
+	os.WriteFile(live, []byte("EDITED"), 0644)
+	if data, _ := os.ReadFile(items[1].TrashPath); string(data) != content {
+		t.Errorf("Editing an outside link changed another item: %q", data)
+	}
+	for _, blob := range items[1].Blobs {
+		if hash, _ := hashFile(mgr.blobPath(blob.Hash)); hash != blob.Hash {
+			t.Errorf("Blob %s no longer matches its content", blob.Hash)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	trashDir := filepath.Join(tempDir, "trash")
+	mgr, _ := NewManager(trashDir)
+	if err := mgr.UseKey([]byte("correct horse")); err != nil {
+		t.Fatalf("UseKey failed: %v", err)
+	}
+
+	secret := make([]byte, 3*sealChunk+100)
+	rand.New(rand.NewSource(1)).Read(secret)
+	envFile := filepath.Join(tempDir, "prod.env")
+	os.WriteFile(envFile, []byte("API_TOKEN=hunter2\n"), 0600)
+	keys := filepath.Join(tempDir, "keys")
+	os.MkdirAll(filepath.Join(keys, "old"), 0700)
+	os.WriteFile(filepath.Join(keys, "old", "id_ed25519"), secret, 0600)
+	for _, path := range []string{envFile, keys} {
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put %s: %v", path, err)
+		}
+	}
+
+	// Nothing in the trash gives away names or content
+	filepath.WalkDir(trashDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, _ := os.ReadFile(path)
+		rel, _ := filepath.Rel(trashDir, path)
+		for _, leak := range []string{"prod.env", "hunter2", "id_ed25519", tempDir} {
+			if strings.Contains(rel, leak) || bytes.Contains(data, []byte(leak)) {
+				t.Errorf("%s gives away %q", path, leak)
+			}
+		}
+		return nil
+	})
+
+	// Without the key, only opaque items
+	locked, _ := NewManager(trashDir)
+	if !locked.Encrypted() || locked.HasKey() {
+		t.Error("Expected an encrypted trash without its key")
+	}
+	items, _ := locked.List()
+	if len(items) != 2 || !items[0].Locked || items[0].OriginalPath != "" {
+		t.Fatalf("Expected 2 locked items, got %+v", items)
+	}
+	if err := locked.Restore(filepath.Base(items[0].TrashPath)); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Restore without key = %v, want ErrNoKey", err)
+	}
+	other := filepath.Join(tempDir, "other.txt")
+	os.WriteFile(other, []byte("x"), 0644)
+	if err := locked.Put(other); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Put without key = %v, want ErrNoKey", err)
+	}
+	if err := locked.UseKey([]byte("wrong")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("UseKey with a wrong key = %v, want ErrWrongKey", err)
+	}
+
+	// With the key, everything reads and restores
+	if err := locked.UseKey([]byte("correct horse")); err != nil {
+		t.Fatalf("UseKey failed: %v", err)
+	}
+	items, _ = locked.List()
+	byPath := map[string]Item{}
+	for _, item := range items {
+		byPath[item.OriginalPath] = item
+	}
+	envItem, keysItem := byPath[envFile], byPath[keys]
+	if envItem.Size != 18 || envItem.IsDir() || !keysItem.IsDir() {
+		t.Fatalf("Unexpected items: %+v", items)
+	}
+	r, err := locked.Open(filepath.Base(envItem.TrashPath), "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "API_TOKEN=hunter2\n" {
+		t.Errorf("Open read %q", data)
+	}
+	r.Close()
+	fsys, err := locked.ItemFS(filepath.Base(keysItem.TrashPath))
+	if err != nil {
+		t.Fatalf("ItemFS failed: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "old/id_ed25519"); err != nil || !bytes.Equal(data, secret) {
+		t.Errorf("ItemFS content mismatch: %v", err)
+	}
+
+	for _, item := range items {
+		if err := locked.Restore(filepath.Base(item.TrashPath)); err != nil {
+			t.Fatalf("Failed to restore %s: %v", item.OriginalPath, err)
+		}
+	}
+	if info, err := os.Stat(envFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Restored file mode not kept: %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(keys, "old", "id_ed25519")); !bytes.Equal(data, secret) {
+		t.Error("Restored content mismatch")
+	}
+
+	// Damaged content is refused
+	mgr.Put(envFile)
+	items, _ = mgr.List()
+	data, _ := os.ReadFile(items[0].TrashPath)
+	data[len(data)-1] ^= 1
+	os.WriteFile(items[0].TrashPath, data, 0600)
+	if err := mgr.Restore(filepath.Base(items[0].TrashPath)); err == nil {
+		t.Error("Restoring damaged content should fail")
+	}
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be restored from damaged content: %v", err)
+	}
+}
+
+func TestShred(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	secret := strings.Repeat("secret\n", 1000)
+	dir := filepath.Join(tempDir, "private")
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "notes.txt"), []byte(secret), 0444)
+	os.WriteFile(filepath.Join(tempDir, "shared.txt"), []byte(secret), 0644)
+	os.Link(filepath.Join(tempDir, "shared.txt"), filepath.Join(dir, "link.txt"))
+
+	item, err := mgr.PutWith(dir, PutOptions{})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	var done, total int64
+	opts := ShredOptions{Passes: 2, Random: true, Progress: func(d, t int64) { done, total = d, t }}
+	if err := mgr.Shred(filepath.Base(item.TrashPath), opts); err != nil {
+		t.Fatalf("Shred failed: %v", err)
+	}
+	if total == 0 || done != total || total < 2*int64(len(secret)) {
+		t.Errorf("Progress ended at %d of %d", done, total)
+	}
+	for _, sub := range []string{"files", "info"} {
+		if entries, _ := os.ReadDir(filepath.Join(tempDir, "trash", sub)); len(entries) != 0 {
+			t.Errorf("%s still holds %d entries", sub, len(entries))
+		}
+	}
+
+	// A file linked from outside the trash is only unlinked
+	if data, _ := os.ReadFile(filepath.Join(tempDir, "shared.txt")); string(data) != secret {
+		t.Error("Shred overwrote a file linked from outside the trash")
+	}
+	if err := mgr.Shred("missing", opts); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Shred of a missing item = %v, want ErrNotFound", err)
+	}
+
+	// Content that other items share survives; the rest goes with ShredAll
+	if !hardlinks {
+		return
+	}
+	var items []Item
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, []byte(secret), 0644)
+		item, err := mgr.PutWith(path, PutOptions{Dedup: true})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+		items = append(items, item)
+	}
+	if err := mgr.Shred(filepath.Base(items[0].TrashPath), ShredOptions{}); err != nil {
+		t.Fatalf("Shred failed: %v", err)
+	}
+	if data, _ := os.ReadFile(items[1].TrashPath); string(data) != secret {
+		t.Error("Shred overwrote content another item shares")
+	}
+	if err := mgr.ShredAll(ShredOptions{}); err != nil {
+		t.Fatalf("ShredAll failed: %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 0 {
+		t.Errorf("ShredAll left %d items", len(items))
+	}
+	if _, err := os.Stat(mgr.blobPath(items[1].Blobs[0].Hash)); !os.IsNotExist(err) {
+		t.Errorf("ShredAll left the blob: %v", err)
+	}
+}
+
+func TestPurgatory(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	var names []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		item, err := mgr.PutWith(path, PutOptions{})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+		names = append(names, filepath.Base(item.TrashPath))
+	}
+
+	now := time.Now()
+	drop, err := mgr.NewDrop(now, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewDrop failed: %v", err)
+	}
+	if err := mgr.MoveToPurgatory(names[0], drop); err != nil {
+		t.Fatalf("MoveToPurgatory failed: %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 1 {
+		t.Errorf("Expected 1 item left in the trash, got %d", len(items))
+	}
+	drops, err := mgr.Drops()
+	if err != nil || len(drops) != 1 || len(drops[0].Items) != 1 {
+		t.Fatalf("Drops() = %+v, %v; expected one drop of one item", drops, err)
+	}
+
+	restored, err := mgr.Undo(drops[0])
+	if err != nil || len(restored) != 1 || restored[0].OriginalPath != filepath.Join(tempDir, "a.txt") {
+		t.Fatalf("Undo() = %+v, %v", restored, err)
+	}
+	if items, _ := mgr.List(); len(items) != 2 {
+		t.Errorf("Expected both items back, got %d", len(items))
+	}
+
+	// Emptied items wait out the grace period, then go for good
+	if _, err := mgr.EmptyToPurgatory(now, time.Hour, &ShredOptions{}); err != nil {
+		t.Fatalf("EmptyToPurgatory failed: %v", err)
+	}
+	if items, _ := mgr.List(); len(items) != 0 {
+		t.Errorf("Expected an empty trash, got %d items", len(items))
+	}
+	if expired, err := mgr.ExpireDrops(now.Add(time.Minute)); err != nil || len(expired) != 0 {
+		t.Errorf("ExpireDrops before the grace period ended = %+v, %v", expired, err)
+	}
+	expired, err := mgr.ExpireDrops(now.Add(2 * time.Hour))
+	if err != nil || len(expired) != 1 || len(expired[0].Items) != 2 {
+		t.Fatalf("ExpireDrops() = %+v, %v; expected one drop of two items", expired, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "trash", "purgatory")); !os.IsNotExist(err) {
+		t.Errorf("Purgatory should be gone with its last drop: %v", err)
+	}
+	if drops, _ := mgr.Drops(); len(drops) != 0 {
+		t.Errorf("Nothing should be left to undo, got %d drops", len(drops))
+	}
+}
+
+func TestPinned(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+
+	var names []string
+	for _, name := range []string{"old.sql", "scratch.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		item, err := mgr.PutWith(path, PutOptions{Note: "old migration", Tags: []string{"db"}})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+		names = append(names, filepath.Base(item.TrashPath))
+	}
+	if err := mgr.SetPinned(names[0], true); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+	if err := mgr.SetPinned("missing", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetPinned of a missing item = %v, want ErrNotFound", err)
+	}
+
+	// Neither age nor size purges a pinned item
+	purged, err := mgr.Purge(Policy{MaxAge: time.Nanosecond, MaxSize: 1}, time.Now().Add(time.Hour))
+	if err != nil || len(purged) != 1 || filepath.Base(purged[0].TrashPath) != names[1] {
+		t.Fatalf("Purge() = %+v, %v; expected only the unpinned item", purged, err)
+	}
+	items, _ := mgr.List()
+	if len(items) != 1 || !items[0].Pinned || items[0].Note != "old migration" || !items[0].HasTag("db") {
+		t.Errorf("Expected the pinned item with its note and tags, got %+v", items)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+	now := time.Now()
+
+	put := func(name string, expiresAt time.Time) string {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		item, err := mgr.PutWith(path, PutOptions{ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+		return filepath.Base(item.TrashPath)
+	}
+	scratch := put("scratch.bin", now.Add(2*24*time.Hour))
+	keep := put("keep.txt", now.Add(90*24*time.Hour))
+	put("plain.txt", time.Time{})
+
+	// A week on, the item's own expiry wins over a month of retention, and
+	// a day on, over a day of retention
+	purged, err := mgr.Purge(Policy{MaxAge: 30 * 24 * time.Hour}, now.Add(7*24*time.Hour))
+	if err != nil || len(purged) != 1 || filepath.Base(purged[0].TrashPath) != scratch {
+		t.Fatalf("Purge() = %+v, %v; expected only scratch.bin", purged, err)
+	}
+	purged, err = mgr.Purge(Policy{MaxAge: time.Hour}, now.Add(24*time.Hour))
+	if err != nil || len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "plain.txt" {
+		t.Fatalf("Purge() = %+v, %v; expected only plain.txt", purged, err)
+	}
+
+	later := now.Add(200 * 24 * time.Hour)
+	if err := mgr.SetExpiry(keep, later); err != nil {
+		t.Fatalf("SetExpiry failed: %v", err)
+	}
+	items, _ := mgr.List()
+	if len(items) != 1 {
+		t.Fatalf("Expected keep.txt to be left, got %d items", len(items))
+	}
+	if expiry, ok := items[0].Expiry(time.Hour); !ok || !expiry.Equal(later) {
+		t.Errorf("Expected keep.txt to expire at %v, got %v, %v", later, expiry, ok)
+	}
+}
+
+func TestPurgeRetentionRules(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+	now := time.Now()
+
+	for _, name := range []string{"build.log", "notes.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, []byte(strings.Repeat(name, 100)), 0644)
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put %s: %v", name, err)
+		}
+	}
+
+	// Logs are kept a day, everything else a month
+	policy := Policy{
+		MaxAge: 30 * 24 * time.Hour,
+		MaxAgeFor: func(originalPath string) (time.Duration, bool) {
+			return 24 * time.Hour, strings.HasSuffix(originalPath, ".log")
+		},
+	}
+	purged, err := mgr.Purge(policy, now.Add(2*24*time.Hour))
+	if err != nil || len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "build.log" {
+		t.Fatalf("Purge() = %+v, %v; expected only build.log", purged, err)
+	}
+
+	items, _ := mgr.List()
+	if len(items) != 1 {
+		t.Fatalf("Expected notes.txt to be left, got %d items", len(items))
+	}
+	item, err := mgr.CompressItem(filepath.Base(items[0].TrashPath))
+	if err != nil || item.Compression != CompressionGzip || item.StoredSize >= item.Size {
+		t.Errorf("CompressItem() = %+v, %v; expected a smaller gzip item", item, err)
+	}
+
+	path := filepath.Join(tempDir, "image.iso")
+	os.WriteFile(path, []byte("iso"), 0644)
+	if err := mgr.Delete(path); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected image.iso to be gone, got %v", err)
+	}
+	if err := mgr.Delete(path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing file should fail with ErrNotFound, got %v", err)
+	}
+	if err := mgr.Delete(filepath.Join(tempDir, "trash", "files")); !errors.Is(err, ErrProtected) {
+		t.Errorf("Delete of the trash should fail with ErrProtected, got %v", err)
+	}
+}
+
+func TestDiskPressure(t *testing.T) {
+	free := int64(950)
+	diskFree = func(string) (int64, error) { return free, nil }
+	t.Cleanup(func() { diskFree = statFree })
+
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+	now := time.Now()
+	for i, age := range []int{10, 5, 1} {
+		path := filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i))
+		os.WriteFile(path, make([]byte, 100), 0644)
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put file: %v", err)
+		}
+		setDeletedAt(t, mgr, path, now.Add(-time.Duration(age)*24*time.Hour))
+	}
+
+	// The run that trashed the items leaves them alone
+	if purged, err := mgr.Purge(Policy{MinFree: 1100}, now); err != nil || len(purged) != 0 {
+		t.Fatalf("Purge() = %v, %v; expected the own batch to be kept", purged, err)
+	}
+
+	// 150 bytes short takes the two oldest items
+	other, _ := NewManager(mgr.trashDir)
+	other.batch = "later-run"
+	purged, err := other.Purge(Policy{MinFree: 1100}, now)
+	if err != nil || len(purged) != 2 || filepath.Base(purged[0].OriginalPath) != "file0.txt" || filepath.Base(purged[1].OriginalPath) != "file1.txt" {
+		t.Fatalf("Purge() = %v, %v; expected the two oldest items", purged, err)
+	}
+
+	// Sealing copies data, so it must stay above the floor; renames need no room
+	sealed, _ := NewManager(filepath.Join(tempDir, "sealed"))
+	if err := sealed.UseKey([]byte("correct horse")); err != nil {
+		t.Fatalf("UseKey failed: %v", err)
+	}
+	path := filepath.Join(tempDir, "big.bin")
+	os.WriteFile(path, make([]byte, 500), 0644)
+	sealed.SetFreeFloor(600)
+	if _, err := sealed.PutWith(path, PutOptions{}); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Expected ErrNoSpace below the floor, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("A refused put must leave the file: %v", err)
+	}
+	sealed.SetFreeFloor(400)
+	if _, err := sealed.PutWith(path, PutOptions{}); err != nil {
+		t.Errorf("Put above the floor failed: %v", err)
+	}
+	path = filepath.Join(tempDir, "plain.bin")
+	os.WriteFile(path, make([]byte, 500), 0644)
+	mgr.SetFreeFloor(2000)
+	if _, err := mgr.PutWith(path, PutOptions{}); err != nil {
+		t.Errorf("A rename should not need room, got %v", err)
+	}
+
+	// Compressing and unarchiving write copies too
+	items, _ := mgr.List()
+	if _, err := mgr.CompressItem(filepath.Base(items[0].TrashPath)); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Expected ErrNoSpace compressing below the floor, got %v", err)
+	}
+	var archive bytes.Buffer
+	if err := mgr.Archive(&archive, []string{filepath.Base(items[0].TrashPath)}); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	restored, _ := NewManager(filepath.Join(tempDir, "restored"))
+	restored.SetFreeFloor(2000)
+	results, err := restored.Unarchive(&archive)
+	if err != nil || len(results) != 1 || !errors.Is(results[0].Err, ErrNoSpace) {
+		t.Errorf("Unarchive() = %v, %v; expected ErrNoSpace below the floor", results, err)
+	}
+	if left, _ := restored.List(); len(left) != 0 {
+		t.Errorf("A refused unarchive must keep nothing, got %v", left)
+	}
+}
+
+func TestPurgeDrops(t *testing.T) {
+	free := int64(950)
+	diskFree = func(string) (int64, error) { return free, nil }
+	t.Cleanup(func() { diskFree = statFree })
+
+	tempDir := t.TempDir()
+	mgr, _ := NewManager(filepath.Join(tempDir, "trash"))
+	for _, name := range []string{"kept.txt", "dropped.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, make([]byte, 100), 0644)
+		if err := mgr.Put(path); err != nil {
+			t.Fatalf("Failed to put file: %v", err)
+		}
+	}
+
+	now := time.Now()
+	drop, err := mgr.NewDrop(now, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewDrop failed: %v", err)
+	}
+	items, _ := mgr.List()
+	for _, item := range items {
+		if filepath.Base(item.OriginalPath) == "dropped.txt" {
+			if err := mgr.MoveToPurgatory(filepath.Base(item.TrashPath), drop); err != nil {
+				t.Fatalf("MoveToPurgatory failed: %v", err)
+			}
+		}
+	}
+
+	// 50 bytes short is freed from purgatory before any trashed item
+	other, _ := NewManager(mgr.trashDir)
+	other.batch = "later-run"
+	purged, err := other.Purge(Policy{MinFree: 1000}, now)
+	if err != nil || len(purged) != 1 || filepath.Base(purged[0].OriginalPath) != "dropped.txt" {
+		t.Fatalf("Purge() = %v, %v; expected the dropped item", purged, err)
+	}
+	if drops, _ := mgr.Drops(); len(drops) != 0 {
+		t.Errorf("Expected purgatory to be empty, got %v", drops)
+	}
+	if items, _ := mgr.List(); len(items) != 1 {
+		t.Errorf("Expected the trashed item to stay, got %v", items)
+	}
+}
@@ -0,0 +1,339 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cj3636/GoCycled/pkg/paths"
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// Scoring weights for fuzzy matching, modelled on fzf: every matched rune
+// scores, gaps cost a little, and matches at the start of a word or path
+// segment or in a run of consecutive runes earn bonuses.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	bonusSegment      = 10 // After a path separator
+	bonusBoundary     = 8  // After another delimiter such as "_" or "."
+	bonusCamel        = 7  // Lower-to-upper or letter-to-digit transition
+	bonusConsecutive  = 4
+)
+
+// Match is the result of fuzzy matching a query against a string
+type Match struct {
+	Score     int
+	Positions []int // Rune indices of the matched characters, ascending
+}
+
+// FuzzyMatch matches query against s fzf-style: every rune of each
+// space-separated term must appear in s in order, not necessarily adjacent.
+// Matching ignores case unless the query contains an upper-case letter.
+func FuzzyMatch(query, s string) (Match, bool) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return Match{}, true
+	}
+
+	caseSensitive := strings.IndexFunc(query, unicode.IsUpper) >= 0
+	text := []rune(s)
+
+	var result Match
+	seen := map[int]bool{}
+	for _, term := range terms {
+		m, ok := matchTerm([]rune(term), text, caseSensitive)
+		if !ok {
+			return Match{}, false
+		}
+		result.Score += m.Score
+		for _, pos := range m.Positions {
+			if !seen[pos] {
+				seen[pos] = true
+				result.Positions = append(result.Positions, pos)
+			}
+		}
+	}
+	sort.Ints(result.Positions)
+	return result, true
+}
+
+// matchTerm finds the shortest window of text that contains pattern as a
+// subsequence, scanning forward for the first complete match and then
+// backward to tighten its start, and scores it
+func matchTerm(pattern, text []rune, caseSensitive bool) (Match, bool) {
+	eq := func(a, b rune) bool {
+		if caseSensitive {
+			return a == b
+		}
+		return unicode.ToLower(a) == unicode.ToLower(b)
+	}
+
+	pi, end := 0, -1
+	for i, r := range text {
+		if eq(r, pattern[pi]) {
+			pi++
+			if pi == len(pattern) {
+				end = i + 1
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return Match{}, false
+	}
+
+	start := 0
+	pi = len(pattern) - 1
+	for i := end - 1; i >= 0; i-- {
+		if eq(text[i], pattern[pi]) {
+			pi--
+			if pi < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	var m Match
+	prevClass := classDelimiter
+	if start > 0 {
+		prevClass = runeClassOf(text[start-1])
+	}
+
+	inGap := false
+	consecutive, firstBonus := 0, 0
+	pi = 0
+	for i := start; i < end; i++ {
+		class := runeClassOf(text[i])
+		if pi < len(pattern) && eq(text[i], pattern[pi]) {
+			m.Positions = append(m.Positions, i)
+			m.Score += scoreMatch
+
+			bonus := bonusFor(prevClass, class, text, i)
+			if consecutive == 0 {
+				firstBonus = bonus
+			} else {
+				// A run keeps the bonus of the boundary that started it
+				if bonus >= bonusBoundary && bonus > firstBonus {
+					firstBonus = bonus
+				}
+				bonus = max(bonus, firstBonus, bonusConsecutive)
+			}
+			if pi == 0 {
+				bonus *= 2
+			}
+			m.Score += bonus
+
+			inGap = false
+			consecutive++
+			pi++
+		} else {
+			if inGap {
+				m.Score += scoreGapExtension
+			} else {
+				m.Score += scoreGapStart
+			}
+			inGap = true
+			consecutive, firstBonus = 0, 0
+		}
+		prevClass = class
+	}
+
+	// Matches that fall within the final path segment usually name the file
+	// the user is thinking of
+	if lastSep := lastIndexRune(text, '/'); start > lastSep {
+		m.Score += scoreMatch
+	}
+	return m, true
+}
+
+type runeClass int
+
+const (
+	classLower runeClass = iota
+	classUpper
+	classDigit
+	classDelimiter
+	classOther
+)
+
+func runeClassOf(r rune) runeClass {
+	switch {
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsDigit(r):
+		return classDigit
+	case r == '/' || r == '_' || r == '-' || r == '.' || r == ' ':
+		return classDelimiter
+	default:
+		return classOther
+	}
+}
+
+// bonusFor returns the bonus for matching the rune at text[i] given the
+// class of the rune before it
+func bonusFor(prev, class runeClass, text []rune, i int) int {
+	if class == classDelimiter {
+		return 0
+	}
+	switch {
+	case prev == classDelimiter:
+		if i == 0 || text[i-1] == '/' {
+			return bonusSegment
+		}
+		return bonusBoundary
+	case prev == classLower && class == classUpper,
+		prev != classDigit && class == classDigit:
+		return bonusCamel
+	}
+	return 0
+}
+
+func lastIndexRune(text []rune, r rune) int {
+	for i := len(text) - 1; i >= 0; i-- {
+		if text[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Ranked is a trash item that matched a query, with its final score
+type Ranked struct {
+	Index int // Position in the slice passed to Rank
+	Item  trash.Item
+	Match Match
+	Score int
+}
+
+// Matcher ranks trash items against fuzzy queries. On top of the match
+// score it favours recently deleted items and items that lived in or near
+// the current working directory.
+type Matcher struct {
+	Now time.Time
+	Cwd string
+}
+
+// NewMatcher creates a matcher for the current time and working directory
+func NewMatcher() *Matcher {
+	cwd, _ := os.Getwd()
+	return &Matcher{Now: time.Now(), Cwd: cwd}
+}
+
+// Rank returns the items that match query, best first. With an empty query
+// every item is returned in its original order. Items whose path does not
+// match can still match by note or tag, with no positions to highlight.
+func (m *Matcher) Rank(items []trash.Item, query string) []Ranked {
+	var ranked []Ranked
+	for i, item := range items {
+		match, ok := FuzzyMatch(query, item.OriginalPath)
+		if !ok && (item.Note != "" || len(item.Tags) > 0) {
+			match, ok = FuzzyMatch(query, item.Note+" "+strings.Join(item.Tags, " "))
+			match.Positions = nil
+		}
+		if !ok {
+			continue
+		}
+		ranked = append(ranked, Ranked{
+			Index: i,
+			Item:  item,
+			Match: match,
+			Score: match.Score + m.recencyBonus(item) + m.cwdBonus(item),
+		})
+	}
+
+	if strings.TrimSpace(query) == "" {
+		return ranked
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Item.OriginalPath) != len(b.Item.OriginalPath) {
+			return len(a.Item.OriginalPath) < len(b.Item.OriginalPath)
+		}
+		return a.Item.DeletedAt.After(b.Item.DeletedAt)
+	})
+	return ranked
+}
+
+// recencyBonus favours items deleted recently
+func (m *Matcher) recencyBonus(item trash.Item) int {
+	age := m.Now.Sub(item.DeletedAt)
+	switch {
+	case age < time.Hour:
+		return 20
+	case age < 24*time.Hour:
+		return 12
+	case age < 7*24*time.Hour:
+		return 6
+	case age < 30*24*time.Hour:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// cwdBonus favours items from the current working directory, and to a
+// lesser degree items that share leading path segments with it
+func (m *Matcher) cwdBonus(item trash.Item) int {
+	if m.Cwd == "" {
+		return 0
+	}
+
+	dir := filepath.Dir(item.OriginalPath)
+	if dir == m.Cwd {
+		return 20
+	}
+	if paths.Within(m.Cwd, dir) {
+		return 15
+	}
+
+	cwdParts := strings.Split(strings.Trim(m.Cwd, "/"), "/")
+	dirParts := strings.Split(strings.Trim(dir, "/"), "/")
+	shared := 0
+	for shared < len(cwdParts) && shared < len(dirParts) && cwdParts[shared] == dirParts[shared] {
+		shared++
+	}
+	return min(shared*2, 10)
+}
+
+// Highlight wraps the runes of s at the given positions in on/off escape
+// sequences. Positions past the end of s are ignored.
+func Highlight(s string, positions []int, on, off string) string {
+	if len(positions) == 0 {
+		return s
+	}
+
+	marked := map[int]bool{}
+	for _, pos := range positions {
+		marked[pos] = true
+	}
+
+	var b strings.Builder
+	inside := false
+	for i, r := range []rune(s) {
+		if marked[i] != inside {
+			inside = marked[i]
+			if inside {
+				b.WriteString(on)
+			} else {
+				b.WriteString(off)
+			}
+		}
+		b.WriteRune(r)
+	}
+	if inside {
+		b.WriteString(off)
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package ui
+
+import "unicode/utf8"
+
+// keyCode identifies a decoded key press
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+	keyEnter
+	keyEsc
+	keyBackspace
+	keyTab
+	keyCtrlC
+	keyCtrlU
+	keyUnknown
+)
+
+// keyEvent is a single key press read from a raw-mode terminal
+type keyEvent struct {
+	code keyCode
+	r    rune
+}
+
+// is reports whether the event is the printable rune r
+func (e keyEvent) is(r rune) bool {
+	return e.code == keyRune && e.r == r
+}
+
+// decodeKeys splits raw terminal input into key events. A single read may
+// contain several keys when input is pasted or typed quickly.
+func decodeKeys(b []byte) []keyEvent {
+	var events []keyEvent
+	for len(b) > 0 {
+		ev, n := decodeKey(b)
+		events = append(events, ev)
+		b = b[n:]
+	}
+	return events
+}
+
+// decodeKey decodes the first key in b and returns it with the number of
+// bytes consumed
+func decodeKey(b []byte) (keyEvent, int) {
+	switch c := b[0]; {
+	case c == 0x1b:
+		if len(b) > 1 && (b[1] == '[' || b[1] == 'O') {
+			return decodeEscape(b)
+		}
+		return keyEvent{code: keyEsc}, 1
+	case c == '\r' || c == '\n':
+		return keyEvent{code: keyEnter}, 1
+	case c == 0x7f || c == 0x08:
+		return keyEvent{code: keyBackspace}, 1
+	case c == '\t':
+		return keyEvent{code: keyTab}, 1
+	case c == 0x03:
+		return keyEvent{code: keyCtrlC}, 1
+	case c == 0x15:
+		return keyEvent{code: keyCtrlU}, 1
+	case c < 0x20:
+		return keyEvent{code: keyUnknown}, 1
+	}
+
+	r, n := utf8.DecodeRune(b)
+	if r == utf8.RuneError {
+		return keyEvent{code: keyUnknown}, n
+	}
+	return keyEvent{code: keyRune, r: r}, n
+}
+
+// decodeEscape decodes a CSI or SS3 sequence such as "\x1b[A" or "\x1b[5~"
+func decodeEscape(b []byte) (keyEvent, int) {
+	// Parameters run until the final byte in the range 0x40-0x7e
+	i := 2
+	for i < len(b) && (b[i] < 0x40 || b[i] > 0x7e) {
+		i++
+	}
+	if i >= len(b) {
+		return keyEvent{code: keyUnknown}, len(b)
+	}
+	params, final := string(b[2:i]), b[i]
+	n := i + 1
+
+	switch final {
+	case 'A':
+		return keyEvent{code: keyUp}, n
+	case 'B':
+		return keyEvent{code: keyDown}, n
+	case 'C':
+		return keyEvent{code: keyRight}, n
+	case 'D':
+		return keyEvent{code: keyLeft}, n
+	case 'H':
+		return keyEvent{code: keyHome}, n
+	case 'F':
+		return keyEvent{code: keyEnd}, n
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyEvent{code: keyHome}, n
+		case "4", "8":
+			return keyEvent{code: keyEnd}, n
+		case "5":
+			return keyEvent{code: keyPgUp}, n
+		case "6":
+			return keyEvent{code: keyPgDn}, n
+		}
+	}
+	return keyEvent{code: keyUnknown}, n
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parseSelection parses a selection of 1-based item numbers out of n items
+// and returns the chosen 0-based indices in ascending order. The input is a
+// comma or space separated list of terms:
+//
+//	7      a single item
+//	1-3    an inclusive range
+//	10-    item 10 to the end
+//	-3     the first three items
+//	all    every item (also "*")
+//	!4     exclude item 4; ranges can be excluded too ("!2-5")
+//
+// If the selection only contains exclusions they apply to all items, so
+// "!4" selects everything except item 4.
+func parseSelection(input string, n int) ([]int, error) {
+	terms := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty selection")
+	}
+
+	include := make([]bool, n)
+	exclude := make([]bool, n)
+	anyInclude := false
+
+	for _, term := range terms {
+		target := include
+		if strings.HasPrefix(term, "!") {
+			target = exclude
+			term = term[1:]
+		} else {
+			anyInclude = true
+		}
+
+		lo, hi, err := parseRange(term, n)
+		if err != nil {
+			return nil, err
+		}
+		for i := lo; i <= hi; i++ {
+			target[i-1] = true
+		}
+	}
+
+	var indices []int
+	for i := 0; i < n; i++ {
+		if (include[i] || !anyInclude) && !exclude[i] {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("selection matches no items")
+	}
+	return indices, nil
+}
+
+// parseRange parses a single selection term into an inclusive 1-based range
+func parseRange(term string, n int) (int, int, error) {
+	if term == "all" || term == "*" {
+		return 1, n, nil
+	}
+
+	loStr, hiStr, isRange := strings.Cut(term, "-")
+	if !isRange {
+		hiStr = loStr
+	}
+
+	lo, hi := 1, n
+	var err error
+	if loStr != "" {
+		if lo, err = strconv.Atoi(loStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid selection: %s", term)
+		}
+	}
+	if hiStr != "" {
+		if hi, err = strconv.Atoi(hiStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid selection: %s", term)
+		}
+	}
+	if loStr == "" && hiStr == "" {
+		return 0, 0, fmt.Errorf("invalid selection: %s", term)
+	}
+
+	if lo < 1 || hi > n || lo > hi {
+		return 0, 0, fmt.Errorf("selection out of range: %s (1-%d)", term, n)
+	}
+	return lo, hi, nil
+}
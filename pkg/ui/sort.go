@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// SortField selects the key items are ordered by
+type SortField int
+
+const (
+	SortByDate SortField = iota // Newest first
+	SortBySize                  // Largest first
+	SortByPath                  // Alphabetical by original path
+)
+
+// String returns the name of the sort field
+func (f SortField) String() string {
+	switch f {
+	case SortBySize:
+		return "size"
+	case SortByPath:
+		return "path"
+	default:
+		return "date"
+	}
+}
+
+// Next returns the sort field that follows f, wrapping around
+func (f SortField) Next() SortField {
+	return (f + 1) % 3
+}
+
+// ParseSortField parses "date", "size" or "path"
+func ParseSortField(s string) (SortField, error) {
+	switch s {
+	case "date", "deleted":
+		return SortByDate, nil
+	case "size":
+		return SortBySize, nil
+	case "path", "name":
+		return SortByPath, nil
+	default:
+		return SortByDate, fmt.Errorf("unknown sort field: %s", s)
+	}
+}
+
+// SortItems sorts items in place. Dates and sizes sort in descending order
+// and paths in ascending order; reverse flips the order.
+func SortItems(items []trash.Item, field SortField, reverse bool) {
+	less := func(a, b trash.Item) bool {
+		switch field {
+		case SortBySize:
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case SortByPath:
+			if a.OriginalPath != b.OriginalPath {
+				return a.OriginalPath < b.OriginalPath
+			}
+		}
+		return a.DeletedAt.After(b.DeletedAt)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if reverse {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+}
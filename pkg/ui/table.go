@@ -0,0 +1,420 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// Column identifies a column of the item table
+type Column string
+
+const (
+	ColumnID      Column = "id"      // Trash name, as accepted by restore and remove
+	ColumnPath    Column = "path"    // Original path
+	ColumnSize    Column = "size"    // Size of the item
+	ColumnDeleted Column = "deleted" // Deletion time
+	ColumnBatch   Column = "batch"   // Identifier shared by items trashed together
+	ColumnType    Column = "type"    // file, dir or link
+	ColumnTags    Column = "tags"    // Tags, and "pinned" for pinned items
+	ColumnNote    Column = "note"    // Note given when trashing
+	ColumnExpires Column = "expires" // Time left until the item is purged
+)
+
+// AllColumns lists every column in its default display order
+var AllColumns = []Column{ColumnID, ColumnPath, ColumnType, ColumnSize, ColumnDeleted, ColumnExpires, ColumnBatch, ColumnTags, ColumnNote}
+
+// DefaultColumns are shown when no columns are chosen
+var DefaultColumns = []Column{ColumnPath, ColumnDeleted, ColumnSize, ColumnExpires}
+
+// ParseColumns parses a comma-separated list of column names such as
+// "id,path,size"
+func ParseColumns(s string) ([]Column, error) {
+	var columns []Column
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, c := range AllColumns {
+			if Column(name) == c {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columns = append(columns, Column(name))
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	return columns, nil
+}
+
+// TableOptions controls how RenderTable lays out items
+type TableOptions struct {
+	Columns   []Column      // Columns to show; DefaultColumns if empty
+	Width     int           // Maximum line width; 0 disables truncation
+	Color     bool          // Color rows by item type and age
+	Relative  bool          // Show deletion times as "3h ago"
+	Now       time.Time     // Reference time for ages; time.Now() if zero
+	Retention time.Duration // When items without their own expiry are purged; 0 keeps them
+}
+
+// DefaultTableOptions returns options for writing to stdout: the terminal
+// width if stdout is a terminal, and color unless NO_COLOR is set
+func DefaultTableOptions() TableOptions {
+	return TableOptions{
+		Columns: DefaultColumns,
+		Width:   TerminalWidth(),
+		Color:   ColorEnabled(),
+	}
+}
+
+// TerminalWidth returns the width of the terminal on stdout, or 0 if stdout
+// is not a terminal
+func TerminalWidth() int {
+	width, _, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// ColorEnabled reports whether colored output should be written to stdout.
+// It honours the NO_COLOR convention (https://no-color.org).
+func ColorEnabled() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(int(os.Stdout.Fd()))
+}
+
+// ANSI styles used by the table
+const (
+	styleReset  = "\x1b[0m"
+	styleBold   = "\x1b[1m"
+	styleDim    = "\x1b[2m"
+	styleBlue   = "\x1b[34m"
+	styleCyan   = "\x1b[36m"
+	styleGreen  = "\x1b[32m"
+	styleYellow = "\x1b[33m"
+	styleRed    = "\x1b[31m"
+)
+
+// RenderTable writes items as an aligned table. When a width is set the
+// path column shrinks to fit, truncating paths in the middle so the file
+// name stays visible.
+func RenderTable(w io.Writer, items []trash.Item, opts TableOptions) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Build the plain cells first so widths can be measured
+	rows := make([][]string, len(items))
+	kinds := make([]string, len(items))
+	for i, item := range items {
+		kinds[i] = itemKind(item)
+		rows[i] = make([]string, len(columns))
+		for j, c := range columns {
+			rows[i][j] = cellText(item, c, kinds[i], now, opts)
+		}
+	}
+
+	widths := make([]int, len(columns))
+	for j, c := range columns {
+		widths[j] = utf8.RuneCountInString(columnTitle(c))
+		for _, row := range rows {
+			widths[j] = max(widths[j], utf8.RuneCountInString(row[j]))
+		}
+	}
+
+	// Give the path column whatever is left of the line
+	if opts.Width > 0 {
+		for j, c := range columns {
+			if c != ColumnPath {
+				continue
+			}
+			others := 2 * (len(columns) - 1)
+			for k, width := range widths {
+				if k != j {
+					others += width
+				}
+			}
+			widths[j] = max(min(widths[j], opts.Width-others), 12)
+		}
+	}
+
+	var header []string
+	for j, c := range columns {
+		header = append(header, padCell(columnTitle(c), widths[j], c == ColumnSize))
+	}
+	total := 0
+	for _, width := range widths {
+		total += width
+	}
+	total += 2 * (len(columns) - 1)
+
+	fmt.Fprintln(w, styled(strings.TrimRight(strings.Join(header, "  "), " "), styleBold, opts.Color))
+	fmt.Fprintln(w, strings.Repeat("-", total))
+
+	for i, row := range rows {
+		var cells []string
+		for j, c := range columns {
+			text := row[j]
+			if c == ColumnPath {
+				text = TruncateMiddle(text, widths[j])
+			}
+			cell := padCell(text, widths[j], c == ColumnSize)
+			if opts.Color {
+				cell = styled(cell, cellStyle(items[i], c, kinds[i], now, opts.Retention), true)
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+}
+
+func columnTitle(c Column) string {
+	switch c {
+	case ColumnID:
+		return "ID"
+	case ColumnPath:
+		return "Original Path"
+	case ColumnSize:
+		return "Size"
+	case ColumnDeleted:
+		return "Deleted At"
+	case ColumnBatch:
+		return "Batch"
+	case ColumnType:
+		return "Type"
+	case ColumnTags:
+		return "Tags"
+	case ColumnNote:
+		return "Note"
+	case ColumnExpires:
+		return "Expires"
+	}
+	return string(c)
+}
+
+func cellText(item trash.Item, c Column, kind string, now time.Time, opts TableOptions) string {
+	switch c {
+	case ColumnID:
+		return sanitize(filepath.Base(item.TrashPath))
+	case ColumnPath:
+		if item.Locked {
+			// Sealed metadata: the ID is all there is to show
+			return "[encrypted] " + sanitize(filepath.Base(item.TrashPath))
+		}
+		return sanitize(item.OriginalPath)
+	case ColumnSize:
+		return formatSize(item.Size)
+	case ColumnDeleted:
+		if opts.Relative {
+			return RelativeTime(item.DeletedAt, now)
+		}
+		return item.DeletedAt.Format("2006-01-02 15:04:05")
+	case ColumnBatch:
+		return item.Batch
+	case ColumnType:
+		return kind
+	case ColumnTags:
+		tags := item.Tags
+		if item.Pinned {
+			tags = append([]string{"pinned"}, tags...)
+		}
+		return sanitize(strings.Join(tags, ","))
+	case ColumnNote:
+		return sanitize(item.Note)
+	case ColumnExpires:
+		expiry, ok := item.Expiry(opts.Retention)
+		if !ok {
+			return "never"
+		}
+		return TimeLeft(expiry, now)
+	}
+	return ""
+}
+
+// cellStyle colors the path and type by item type, the deletion time by
+// age (fresh items are green and items older than a month are red) and
+// the expiry by the time left
+func cellStyle(item trash.Item, c Column, kind string, now time.Time, retention time.Duration) string {
+	switch c {
+	case ColumnPath, ColumnType:
+		switch kind {
+		case "dir":
+			return styleBold + styleBlue
+		case "link":
+			return styleCyan
+		}
+	case ColumnDeleted:
+		switch age := now.Sub(item.DeletedAt); {
+		case age < 24*time.Hour:
+			return styleGreen
+		case age > 30*24*time.Hour:
+			return styleRed
+		case age > 7*24*time.Hour:
+			return styleYellow
+		}
+	case ColumnID, ColumnBatch:
+		return styleDim
+	case ColumnTags:
+		if item.Pinned {
+			return styleYellow
+		}
+	case ColumnExpires:
+		expiry, ok := item.Expiry(retention)
+		switch left := expiry.Sub(now); {
+		case !ok:
+			return styleDim
+		case left < 24*time.Hour:
+			return styleRed
+		case left < 7*24*time.Hour:
+			return styleYellow
+		}
+	}
+	return ""
+}
+
+// itemKind returns "file", "dir" or "link" for a trashed item
+func itemKind(item trash.Item) string {
+	if item.Locked {
+		return "?"
+	}
+	if item.Compressed() {
+		if item.IsDir() {
+			return "dir"
+		}
+		return "file"
+	}
+	info, err := os.Lstat(item.TrashPath)
+	switch {
+	case err != nil:
+		return "?"
+	case info.IsDir():
+		return "dir"
+	case info.Mode()&os.ModeSymlink != 0:
+		return "link"
+	default:
+		return "file"
+	}
+}
+
+func styled(s, style string, enabled bool) string {
+	if !enabled || style == "" {
+		return s
+	}
+	return style + s + styleReset
+}
+
+// padCell pads s with spaces to width runes, on the left if alignRight
+func padCell(s string, width int, alignRight bool) string {
+	gap := width - utf8.RuneCountInString(s)
+	if gap <= 0 {
+		return s
+	}
+	if alignRight {
+		return strings.Repeat(" ", gap) + s
+	}
+	return s + strings.Repeat(" ", gap)
+}
+
+// RelativeTime formats the time between t and now as "just now", "5m ago",
+// "3h ago", "2d ago", "6w ago" or "1y ago"
+func RelativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dw ago", int(d.Hours()/(24*7)))
+	default:
+		return fmt.Sprintf("%dy ago", int(d.Hours()/(24*365)))
+	}
+}
+
+// TimeLeft formats the time from now until t as "5m left", "3h left",
+// "2d left", "6w left" or "1y left", or "expired" once t has passed
+func TimeLeft(t, now time.Time) string {
+	d := t.Sub(now)
+	if d <= 0 {
+		return "expired"
+	}
+	// Expiries set a whole number of days ahead read as such a moment later
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm left", max(int(d.Minutes()), 1))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh left", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd left", int(d.Hours()/24))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dw left", int(d.Hours()/(24*7)))
+	default:
+		return fmt.Sprintf("%dy left", int(d.Hours()/(24*365)))
+	}
+}
+
+// TruncateMiddle shortens s to at most max runes by replacing the middle
+// with "…". The final path element is kept whole when it fits, so
+// "/home/user/projects/app/src/main.go" cut to 25 runes becomes
+// "/home/us…/app/src/main.go".
+func TruncateMiddle(s string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	head, tail := middleCut(len(runes), max, utf8.RuneCountInString(filepath.Base(s)))
+	if head+tail >= len(runes) {
+		return s
+	}
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// middleCut decides how many leading and trailing runes of an n-rune path
+// survive truncation to max runes. baseLen is the length of the final path
+// element, which the tail covers along with its separator when possible.
+func middleCut(n, max, baseLen int) (head, tail int) {
+	if n <= max {
+		return n, 0
+	}
+	// No room for more than the "…"
+	if max <= 1 {
+		return 0, 0
+	}
+
+	tail = baseLen + 1
+	if tail > max-1 {
+		// The name alone is too long: keep its end, which holds the extension
+		return 0, max - 1
+	}
+
+	// Split the rest evenly, preferring the end of the path
+	head = (max - 1 - tail) / 2
+	tail = max - 1 - head
+	return head, tail
+}
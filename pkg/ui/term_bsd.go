@@ -0,0 +1,11 @@
+//go:build darwin || freebsd
+
+package ui
+
+import "syscall"
+
+// ioctl requests that read and write a terminal's settings
+const (
+	getTermios = syscall.TIOCGETA
+	setTermios = syscall.TIOCSETA
+)
@@ -0,0 +1,11 @@
+//go:build linux
+
+package ui
+
+import "syscall"
+
+// ioctl requests that read and write a terminal's settings
+const (
+	getTermios = syscall.TCGETS
+	setTermios = syscall.TCSETS
+)
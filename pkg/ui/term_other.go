@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+
+package ui
+
+import "errors"
+
+var errNoTerminal = errors.New("terminal control is only supported on Linux, macOS and FreeBSD")
+
+// isTerminal always reports false so callers fall back to plain output
+func isTerminal(fd int) bool {
+	return false
+}
+
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errNoTerminal
+}
+
+func noEcho(fd int) (func(), error) {
+	return nil, errNoTerminal
+}
@@ -0,0 +1,85 @@
+//go:build linux || darwin || freebsd
+
+package ui
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// winsize mirrors struct winsize from <sys/ioctl.h>
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether fd refers to a terminal
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return ioctl(fd, getTermios, unsafe.Pointer(&t)) == nil
+}
+
+// terminalSize returns the width and height of the terminal behind fd
+func terminalSize(fd int) (width, height int, err error) {
+	var ws winsize
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// noEcho stops the terminal behind fd from echoing input and returns a
+// function that restores the previous state
+func noEcho(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(fd, getTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+
+	quiet := old
+	quiet.Lflag &^= syscall.ECHO
+	if err := ioctl(fd, setTermios, unsafe.Pointer(&quiet)); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(fd, setTermios, unsafe.Pointer(&old))
+	}, nil
+}
+
+// makeRaw puts the terminal behind fd into raw mode and returns a function
+// that restores the previous state. Output processing is left enabled so
+// "\n" still moves to the start of the next line.
+func makeRaw(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(fd, getTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(fd, setTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(fd, setTermios, unsafe.Pointer(&old))
+	}, nil
+}
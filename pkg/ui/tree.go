@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// RenderTree writes the contents of fsys as an indented tree, like tree(1),
+// followed by a summary line with the number of directories and files
+func RenderTree(w io.Writer, fsys fs.FS, root string) error {
+	fmt.Fprintln(w, sanitize(root))
+
+	dirs, files := 0, 0
+	var walk func(dir, prefix string) error
+	walk = func(dir, prefix string) error {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return err
+		}
+
+		for i, entry := range entries {
+			branch, indent := "├── ", "│   "
+			if i == len(entries)-1 {
+				branch, indent = "└── ", "    "
+			}
+
+			name := sanitize(entry.Name())
+			switch {
+			case entry.IsDir():
+				name += "/"
+				dirs++
+			case entry.Type()&fs.ModeSymlink != 0:
+				name += "@"
+				files++
+			default:
+				files++
+			}
+			fmt.Fprintln(w, prefix+branch+name)
+
+			if entry.IsDir() {
+				if err := walk(path.Join(dir, entry.Name()), prefix+indent); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk(".", ""); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n%d directories, %d files\n", dirs, files)
+	return nil
+}
@@ -0,0 +1,747 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+// ErrCancelled is returned when the user leaves a selection without choosing
+var ErrCancelled = errors.New("selection cancelled")
+
+// Browser is implemented by UIs that can browse the trash interactively
+type Browser interface {
+	Browse(actions BrowseActions) error
+}
+
+// BrowseActions connects the browser to the trash manager
+type BrowseActions struct {
+	List    func() ([]trash.Item, error)
+	Restore func(item trash.Item) error
+	Remove  func(item trash.Item) error
+}
+
+// TUI is a full-screen terminal UI. Lists and selections are drawn on the
+// alternate screen in raw mode; prompts and messages behave like BasicUI.
+type TUI struct {
+	*BasicUI
+	in  *os.File
+	out *os.File
+}
+
+// NewTUI returns a full-screen UI when stdin and stdout are terminals and a
+// BasicUI otherwise
+func NewTUI() UI {
+	if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(os.Stdout.Fd())) {
+		return NewBasicUI()
+	}
+	return &TUI{
+		BasicUI: NewBasicUI(),
+		in:      os.Stdin,
+		out:     os.Stdout,
+	}
+}
+
+// SelectItem lets the user pick an item from a full-screen list
+func (t *TUI) SelectItem(items []trash.Item) (string, error) {
+	if len(items) == 0 {
+		return "", fmt.Errorf("no items to select")
+	}
+
+	b := newBrowser(items, false)
+	b.help = "↑/↓ move · / search · s sort · enter select · q cancel"
+
+	var chosen string
+	err := t.run(b, func(ev keyEvent) (bool, error) {
+		switch {
+		case ev.code == keyEnter:
+			if item, ok := b.current(); ok {
+				chosen = item.TrashPath
+				return true, nil
+			}
+		case ev.is('q'), ev.code == keyEsc:
+			return true, ErrCancelled
+		}
+		return false, nil
+	})
+	return chosen, err
+}
+
+// SelectItems lets the user mark several items in a full-screen list. Enter
+// returns the marked items, or the current item if none are marked.
+func (t *TUI) SelectItems(items []trash.Item) ([]string, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items to select")
+	}
+
+	b := newBrowser(items, true)
+	b.help = "↑/↓ move · space mark · a mark all · / search · enter confirm · q cancel"
+
+	var chosen []string
+	err := t.run(b, func(ev keyEvent) (bool, error) {
+		switch {
+		case ev.code == keyEnter:
+			for _, item := range b.targets() {
+				chosen = append(chosen, item.TrashPath)
+			}
+			return len(chosen) > 0, nil
+		case ev.is('q'), ev.code == keyEsc:
+			return true, ErrCancelled
+		}
+		return false, nil
+	})
+	return chosen, err
+}
+
+// Browse opens the interactive trash browser
+func (t *TUI) Browse(actions BrowseActions) error {
+	items, err := actions.List()
+	if err != nil {
+		return err
+	}
+
+	b := newBrowser(items, true)
+	b.help = "↑/↓ move · space mark · / search · s sort · r restore · d remove · i info · q quit"
+
+	// apply runs an action on every target and reloads the list
+	apply := func(verb string, action func(trash.Item) error) {
+		targets := b.targets()
+		done := 0
+		var failures []string
+		for _, item := range targets {
+			if err := action(item); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", filepath.Base(item.OriginalPath), err))
+			} else {
+				done++
+			}
+		}
+
+		if items, err := actions.List(); err == nil {
+			b.setItems(items)
+		}
+		b.selected = map[string]bool{}
+
+		b.status = fmt.Sprintf("%s %d of %d items", verb, done, len(targets))
+		if len(failures) > 0 {
+			b.status += " · failed " + strings.Join(failures, "; ")
+		}
+	}
+
+	return t.run(b, func(ev keyEvent) (bool, error) {
+		if b.info {
+			b.info = false
+			return false, nil
+		}
+
+		switch {
+		case ev.is('q'), ev.code == keyEsc:
+			return true, nil
+		case ev.is('i'), ev.code == keyEnter:
+			if _, ok := b.current(); ok {
+				b.info = true
+			}
+		case ev.is('r'):
+			if n := len(b.targets()); n > 0 {
+				b.ask(fmt.Sprintf("Restore %d item(s)? (y/N)", n), func() {
+					apply("Restored", actions.Restore)
+				})
+			}
+		case ev.is('d'), ev.is('x'):
+			if n := len(b.targets()); n > 0 {
+				b.ask(fmt.Sprintf("Permanently delete %d item(s)? (y/N)", n), func() {
+					apply("Deleted", actions.Remove)
+				})
+			}
+		}
+		return false, nil
+	})
+}
+
+// run enters raw mode on the alternate screen and feeds key presses to the
+// browser until handle reports that it is done
+func (t *TUI) run(b *browser, handle func(keyEvent) (bool, error)) error {
+	restore, err := makeRaw(int(t.in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// Alternate screen, hidden cursor
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+
+	buf := make([]byte, 64)
+	for {
+		t.draw(b)
+
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range decodeKeys(buf[:n]) {
+			if ev.code == keyCtrlC {
+				return ErrCancelled
+			}
+			if b.handleCommon(ev) {
+				continue
+			}
+			done, err := handle(ev)
+			if done || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// draw renders one frame of the browser
+func (t *TUI) draw(b *browser) {
+	width, height, err := terminalSize(int(t.out.Fd()))
+	if err != nil || width < 20 || height < 5 {
+		width, height = 80, 24
+	}
+
+	var lines []string
+	header := fmt.Sprintf(" rc · %d items · sorted by %s", len(b.visible), b.sortName())
+	if n := len(b.selected); n > 0 {
+		header += fmt.Sprintf(" · %d marked", n)
+	}
+	lines = append(lines, "\x1b[7m"+pad(header, width)+"\x1b[0m")
+
+	if b.searching || b.query != "" {
+		search := " / " + b.query
+		if b.searching {
+			search += "▏"
+		}
+		lines = append(lines, pad(search, width))
+	}
+
+	rows := height - len(lines) - 1
+	b.scroll(rows)
+
+	if b.info {
+		lines = append(lines, b.infoLines(width, rows)...)
+	} else {
+		listWidth, previewWidth := width, 0
+		if width >= 80 {
+			listWidth = width * 3 / 5
+			previewWidth = width - listWidth - 1
+		}
+
+		var preview []string
+		if item, ok := b.current(); ok && previewWidth > 0 {
+			preview = previewLines(item, rows)
+		}
+
+		for row := 0; row < rows; row++ {
+			text, positions := b.rowText(b.offset+row, listWidth)
+			line := Highlight(pad(text, listWidth), positions, "\x1b[1;4m", "\x1b[22;24m")
+			if b.offset+row == b.cursor && len(b.visible) > 0 {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			if previewWidth > 0 {
+				p := ""
+				if row < len(preview) {
+					p = preview[row]
+				}
+				line += "│" + pad(p, previewWidth)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	footer := b.help
+	if b.prompt != "" {
+		footer = b.prompt
+	} else if b.status != "" {
+		footer = b.status
+	}
+	lines = append(lines, "\x1b[7m"+pad(" "+footer, width)+"\x1b[0m")
+
+	w := bufio.NewWriter(t.out)
+	w.WriteString("\x1b[H")
+	for i, line := range lines {
+		w.WriteString(line)
+		w.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			w.WriteString("\n")
+		}
+	}
+	w.WriteString("\x1b[J")
+	w.Flush()
+}
+
+// browser holds the state of an interactive list: the items, the filtered
+// and sorted view, the cursor and any marked items
+type browser struct {
+	items    []trash.Item
+	visible  []int // indices into items, in display order
+	cursor   int   // index into visible
+	offset   int   // first visible row
+	multi    bool
+	selected map[string]bool // keyed by TrashPath
+
+	query     string
+	searching bool
+	matcher   *Matcher
+	matches   map[int]Match // keyed by index into items
+	sortField SortField
+	reverse   bool
+
+	info    bool
+	help    string
+	status  string
+	prompt  string
+	confirm func()
+}
+
+func newBrowser(items []trash.Item, multi bool) *browser {
+	b := &browser{
+		multi:    multi,
+		selected: map[string]bool{},
+		matcher:  NewMatcher(),
+	}
+	b.setItems(items)
+	return b
+}
+
+// setItems replaces the items and rebuilds the view, keeping the cursor on
+// the same item when it still exists
+func (b *browser) setItems(items []trash.Item) {
+	keep := b.currentPath()
+	b.items = append([]trash.Item(nil), items...)
+	b.rebuild(keep)
+}
+
+// refresh re-sorts and re-filters the items
+func (b *browser) refresh() {
+	b.rebuild(b.currentPath())
+}
+
+// rebuild recomputes the visible list and moves the cursor to the item at
+// trash path keep, or to the top if it is gone
+func (b *browser) rebuild(keep string) {
+	SortItems(b.items, b.sortField, b.reverse)
+
+	// A search query ranks matches by fuzzy score instead of the sort order
+	b.visible = b.visible[:0]
+	b.matches = map[int]Match{}
+	for _, r := range b.matcher.Rank(b.items, b.query) {
+		b.visible = append(b.visible, r.Index)
+		b.matches[r.Index] = r.Match
+	}
+
+	b.cursor = 0
+	for pos, i := range b.visible {
+		if b.items[i].TrashPath == keep {
+			b.cursor = pos
+			break
+		}
+	}
+}
+
+// current returns the item under the cursor
+func (b *browser) current() (trash.Item, bool) {
+	if b.cursor < 0 || b.cursor >= len(b.visible) {
+		return trash.Item{}, false
+	}
+	return b.items[b.visible[b.cursor]], true
+}
+
+func (b *browser) currentPath() string {
+	if item, ok := b.current(); ok {
+		return item.TrashPath
+	}
+	return ""
+}
+
+// targets returns the marked items, or the current item if none are marked
+func (b *browser) targets() []trash.Item {
+	var targets []trash.Item
+	for _, item := range b.items {
+		if b.selected[item.TrashPath] {
+			targets = append(targets, item)
+		}
+	}
+	if len(targets) == 0 {
+		if item, ok := b.current(); ok {
+			targets = append(targets, item)
+		}
+	}
+	return targets
+}
+
+// ask shows a yes/no prompt in the footer and runs action on "y"
+func (b *browser) ask(prompt string, action func()) {
+	b.prompt = prompt
+	b.confirm = action
+}
+
+func (b *browser) sortName() string {
+	if strings.TrimSpace(b.query) != "" {
+		return "match"
+	}
+	name := b.sortField.String()
+	if b.reverse {
+		name += " (reversed)"
+	}
+	return name
+}
+
+// move shifts the cursor by delta rows, clamped to the list
+func (b *browser) move(delta int) {
+	b.cursor += delta
+	if b.cursor >= len(b.visible) {
+		b.cursor = len(b.visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+// scroll adjusts the offset so the cursor stays within rows
+func (b *browser) scroll(rows int) {
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if rows > 0 && b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+	if b.offset > len(b.visible)-1 {
+		b.offset = 0
+	}
+}
+
+// handleCommon processes keys shared by every browser mode: answering a
+// prompt, editing the search, navigation, sorting and marking. It returns
+// true if the key was consumed.
+func (b *browser) handleCommon(ev keyEvent) bool {
+	if b.info {
+		return false
+	}
+
+	if b.prompt != "" {
+		action := b.confirm
+		b.prompt, b.confirm = "", nil
+		if ev.is('y') || ev.is('Y') {
+			action()
+		}
+		return true
+	}
+
+	if b.searching {
+		switch ev.code {
+		case keyEnter, keyTab:
+			b.searching = false
+		case keyEsc:
+			b.searching = false
+			b.query = ""
+		case keyBackspace:
+			if b.query != "" {
+				_, size := utf8.DecodeLastRuneInString(b.query)
+				b.query = b.query[:len(b.query)-size]
+			}
+		case keyCtrlU:
+			b.query = ""
+		case keyRune:
+			b.query += string(ev.r)
+		case keyUp, keyDown:
+			b.searching = false
+			return b.handleCommon(ev)
+		default:
+			return true
+		}
+		b.refresh()
+		return true
+	}
+
+	b.status = ""
+	pageSize := 10
+	switch {
+	case ev.code == keyUp, ev.is('k'):
+		b.move(-1)
+	case ev.code == keyDown, ev.is('j'):
+		b.move(1)
+	case ev.code == keyPgUp:
+		b.move(-pageSize)
+	case ev.code == keyPgDn:
+		b.move(pageSize)
+	case ev.code == keyHome, ev.is('g'):
+		b.move(-len(b.visible))
+	case ev.code == keyEnd, ev.is('G'):
+		b.move(len(b.visible))
+	case ev.is('/'):
+		b.searching = true
+	case ev.is('s'):
+		b.sortField = b.sortField.Next()
+		b.refresh()
+	case ev.is('S'):
+		b.reverse = !b.reverse
+		b.refresh()
+	case ev.is(' ') && b.multi:
+		if item, ok := b.current(); ok {
+			if b.selected[item.TrashPath] {
+				delete(b.selected, item.TrashPath)
+			} else {
+				b.selected[item.TrashPath] = true
+			}
+			b.move(1)
+		}
+	case ev.is('a') && b.multi:
+		// Mark every visible item, or clear the marks if all are marked
+		all := true
+		for _, i := range b.visible {
+			if !b.selected[b.items[i].TrashPath] {
+				all = false
+				break
+			}
+		}
+		for _, i := range b.visible {
+			if all {
+				delete(b.selected, b.items[i].TrashPath)
+			} else {
+				b.selected[b.items[i].TrashPath] = true
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// rowText formats the row at position pos of the visible list and returns
+// the rune positions within it that matched the search query
+func (b *browser) rowText(pos, width int) (string, []int) {
+	if pos >= len(b.visible) {
+		if pos == 0 {
+			return "  (no matching items)", nil
+		}
+		return "", nil
+	}
+
+	item := b.items[b.visible[pos]]
+	mark := " "
+	if b.multi {
+		mark = "  "
+		if b.selected[item.TrashPath] {
+			mark = "* "
+		}
+	}
+
+	prefix := fmt.Sprintf("%s%s %9s  ", mark, item.DeletedAt.Format("2006-01-02 15:04"), formatSize(item.Size))
+	prefixLen := utf8.RuneCountInString(prefix)
+	path := sanitize(item.OriginalPath)
+	if item.Locked {
+		path = "[encrypted] " + sanitize(filepath.Base(item.TrashPath))
+	}
+	n := utf8.RuneCountInString(path)
+	head, tail := middleCut(n, width-prefixLen, utf8.RuneCountInString(filepath.Base(path)))
+
+	// Map match positions past the cut onto the shortened path; matches in
+	// the elided middle are not shown
+	var positions []int
+	for _, p := range b.matches[b.visible[pos]].Positions {
+		switch {
+		case p < head:
+			positions = append(positions, prefixLen+p)
+		case tail > 0 && p >= n-tail:
+			positions = append(positions, prefixLen+head+1+p-(n-tail))
+		}
+	}
+	return prefix + TruncateMiddle(path, width-prefixLen), positions
+}
+
+// infoLines shows every known detail of the current item
+func (b *browser) infoLines(width, rows int) []string {
+	item, ok := b.current()
+	if !ok {
+		return nil
+	}
+
+	kind := "file"
+	if item.Compressed() {
+		if item.IsDir() {
+			kind = "directory"
+		}
+	} else if info, err := os.Lstat(item.TrashPath); err == nil {
+		switch {
+		case info.IsDir():
+			kind = "directory"
+		case info.Mode()&os.ModeSymlink != 0:
+			kind = "symlink"
+		}
+	}
+
+	fields := [][2]string{
+		{"Original path", item.OriginalPath},
+		{"Trash name", filepath.Base(item.TrashPath)},
+		{"Trash path", item.TrashPath},
+		{"Deleted at", item.DeletedAt.Format("2006-01-02 15:04:05")},
+		{"Size", formatSize(item.Size)},
+		{"Type", kind},
+	}
+	if item.Locked {
+		// Sealed metadata: only what the file system shows is known
+		fields = [][2]string{
+			{"Trash name", filepath.Base(item.TrashPath)},
+			{"Trash path", item.TrashPath},
+			{"Stored size", formatSize(item.StoredSize) + " (encrypted, locked)"},
+		}
+	} else if item.Compressed() {
+		fields = append(fields, [2]string{"Stored size", fmt.Sprintf("%s (%s)", formatSize(item.StoredSize), item.Compression)})
+	}
+	if item.Git != nil {
+		fields = append(fields, [2]string{"Git", item.Git.String()})
+	}
+	if item.Note != "" {
+		fields = append(fields, [2]string{"Note", item.Note})
+	}
+	if len(item.Tags) > 0 {
+		fields = append(fields, [2]string{"Tags", strings.Join(item.Tags, ", ")})
+	}
+	if item.Pinned {
+		fields = append(fields, [2]string{"Pinned", "yes, never purged"})
+	} else if !item.ExpiresAt.IsZero() {
+		fields = append(fields, [2]string{"Expires", item.ExpiresAt.Format("2006-01-02 15:04:05")})
+	}
+
+	lines := []string{""}
+	for _, f := range fields {
+		lines = append(lines, pad(fmt.Sprintf("  %-14s %s", f[0]+":", sanitize(f[1])), width))
+	}
+	lines = append(lines, "", "  Press any key to return")
+	for len(lines) < rows {
+		lines = append(lines, "")
+	}
+	return lines[:rows]
+}
+
+// previewLines returns up to max lines describing the content of a trashed
+// item: the start of a text file, the entries of a directory or a symlink
+// target
+func previewLines(item trash.Item, max int) []string {
+	if item.Locked {
+		// Sealed metadata: the ID and the space taken are all there is
+		lines := []string{
+			"[encrypted] " + sanitize(filepath.Base(item.TrashPath)),
+			formatSize(item.StoredSize) + " on disk",
+			"",
+			"(encrypted; unlock the bin to preview it)",
+		}
+		return lines[:min(len(lines), max)]
+	}
+
+	lines := []string{
+		sanitize(filepath.Base(item.OriginalPath)),
+		fmt.Sprintf("%s · %s", formatSize(item.Size), item.DeletedAt.Format("2006-01-02 15:04")),
+		"",
+	}
+
+	switch {
+	case item.Compression == trash.CompressionSealed:
+		return append(lines, fmt.Sprintf("(encrypted, %s on disk)", formatSize(item.StoredSize)))
+	case item.Compressed():
+		return append(lines, fmt.Sprintf("(compressed to %s)", formatSize(item.StoredSize)))
+	}
+
+	info, err := os.Lstat(item.TrashPath)
+	switch {
+	case err != nil:
+		lines = append(lines, fmt.Sprintf("(unavailable: %v)", err))
+	case info.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(item.TrashPath)
+		lines = append(lines, "→ "+sanitize(target))
+	case info.IsDir():
+		entries, err := os.ReadDir(item.TrashPath)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("(unreadable: %v)", err))
+			break
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for i, entry := range entries {
+			if len(lines) >= max-1 && i < len(entries)-1 {
+				lines = append(lines, fmt.Sprintf("… and %d more", len(entries)-i))
+				break
+			}
+			name := sanitize(entry.Name())
+			if entry.IsDir() {
+				name += "/"
+			}
+			lines = append(lines, name)
+		}
+	default:
+		lines = append(lines, textPreview(item.TrashPath, max-len(lines))...)
+	}
+
+	if len(lines) > max {
+		lines = lines[:max]
+	}
+	return lines
+}
+
+// textPreview reads the first lines of a file, detecting binary content
+func textPreview(path string, max int) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("(unreadable: %v)", err)}
+	}
+	defer f.Close()
+
+	buf := make([]byte, 8192)
+	n, _ := f.Read(buf)
+	buf = buf[:n]
+	if bytes.IndexByte(buf, 0) >= 0 || !utf8.Valid(trimPartialRune(buf)) {
+		return []string{"(binary file)"}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if len(lines) >= max {
+			break
+		}
+		lines = append(lines, sanitize(strings.ReplaceAll(line, "\t", "    ")))
+	}
+	return lines
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence cut off at the end of b
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// sanitize replaces control characters so file names and content can't
+// move the cursor or change terminal state
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// pad truncates or space-pads s to exactly width runes
+func pad(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
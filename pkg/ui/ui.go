@@ -2,8 +2,10 @@ package ui
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/cj3636/GoCycled/pkg/trash"
@@ -12,8 +14,10 @@ import (
 // UI interface for different UI implementations
 type UI interface {
 	Confirm(message string) bool
-	DisplayItems(items []trash.Item)
+	Passphrase(prompt string) (string, error)
+	DisplayItems(items []trash.Item, opts TableOptions)
 	SelectItem(items []trash.Item) (string, error)
+	SelectItems(items []trash.Item) ([]string, error)
 	Success(message string)
 	Error(message string)
 	Info(message string)
@@ -22,12 +26,14 @@ type UI interface {
 // BasicUI is a simple text-based UI
 type BasicUI struct {
 	reader *bufio.Reader
+	styled bool // Escape sequences are allowed, see ColorEnabled
 }
 
 // NewBasicUI creates a new basic UI
 func NewBasicUI() *BasicUI {
 	return &BasicUI{
 		reader: bufio.NewReader(os.Stdin),
+		styled: ColorEnabled(),
 	}
 }
 
@@ -39,50 +45,129 @@ func (u *BasicUI) Confirm(message string) bool {
 	return response == "y" || response == "yes"
 }
 
-// DisplayItems displays a list of trash items
-func (u *BasicUI) DisplayItems(items []trash.Item) {
+// Passphrase asks for a secret on the terminal without echoing it
+func (u *BasicUI) Passphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return "", errors.New("no terminal to ask for a passphrase")
+	}
+	restore, err := noEcho(fd)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("%s: ", prompt)
+	line, err := u.reader.ReadString('\n')
+	restore()
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// DisplayItems displays a list of trash items as a table
+func (u *BasicUI) DisplayItems(items []trash.Item, opts TableOptions) {
 	if len(items) == 0 {
 		fmt.Println("Trash is empty")
 		return
 	}
 
-	fmt.Printf("\n%-40s %-20s %-15s\n", "Original Path", "Deleted At", "Size")
-	fmt.Println(strings.Repeat("-", 80))
-
-	for _, item := range items {
-		size := formatSize(item.Size)
-		deletedAt := item.DeletedAt.Format("2006-01-02 15:04:05")
-		fmt.Printf("%-40s %-20s %-15s\n",
-			truncate(item.OriginalPath, 40),
-			deletedAt,
-			size)
-	}
+	fmt.Println()
+	RenderTable(os.Stdout, items, opts)
 	fmt.Println()
 }
 
-// SelectItem prompts user to select an item
+// SelectItem prompts user to select an item. Typing text instead of a
+// number narrows the list with a fuzzy search.
 func (u *BasicUI) SelectItem(items []trash.Item) (string, error) {
 	if len(items) == 0 {
 		return "", fmt.Errorf("no items to select")
 	}
 
-	for i, item := range items {
-		fmt.Printf("%d. %s\n", i+1, item.OriginalPath)
+	indices, err := u.choose(items, "\nSelect item number (or type to search): ", parseSingle)
+	if err != nil {
+		return "", err
 	}
+	return items[indices[0]].TrashPath, nil
+}
 
-	fmt.Print("\nSelect item number: ")
-	input, err := u.reader.ReadString('\n')
+// SelectItems prompts user to select one or more items. It accepts numbers,
+// ranges and exclusions such as "1-3,7,10-", "all" or "!4"; any other text
+// narrows the list with a fuzzy search.
+func (u *BasicUI) SelectItems(items []trash.Item) ([]string, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items to select")
+	}
+
+	indices, err := u.choose(items, "\nSelect items (e.g. 1-3,7 or all or !4, or type to search): ", parseSelection)
 	if err != nil {
-		return "", fmt.Errorf("failed to read input: %v", err)
+		return nil, err
+	}
+
+	paths := make([]string, len(indices))
+	for i, idx := range indices {
+		paths[i] = items[idx].TrashPath
 	}
+	return paths, nil
+}
+
+// choose prints the items as a numbered list and reads a selection with
+// parse. Input that isn't a valid selection is used as a fuzzy query: the
+// matching items are listed best first, with matched characters highlighted,
+// and the next selection numbers refer to that list. It returns indices into
+// items.
+func (u *BasicUI) choose(items []trash.Item, prompt string, parse func(string, int) ([]int, error)) ([]int, error) {
+	matcher := NewMatcher()
+	view := matcher.Rank(items, "")
+
+	for {
+		for i, r := range view {
+			fmt.Printf("%d. %s\n", i+1, u.highlight(r.Item.OriginalPath, r.Match.Positions))
+		}
+
+		fmt.Print(prompt)
+		input, err := u.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %v", err)
+		}
+		input = strings.TrimSpace(input)
+
+		indices, err := parse(input, len(view))
+		if err == nil {
+			for i, idx := range indices {
+				indices[i] = view[idx].Index
+			}
+			return indices, nil
+		}
+		if input == "" {
+			return nil, err
+		}
+
+		matches := matcher.Rank(items, input)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no items match %q", input)
+		}
+		fmt.Printf("\n%d of %d items match %q:\n", len(matches), len(items), input)
+		view = matches
+	}
+}
 
-	var selection int
-	input = strings.TrimSpace(input)
-	if _, err := fmt.Sscanf(input, "%d", &selection); err != nil || selection < 1 || selection > len(items) {
-		return "", fmt.Errorf("invalid selection")
+// parseSingle parses a single 1-based item number out of n items
+func parseSingle(input string, n int) ([]int, error) {
+	selection, err := strconv.Atoi(input)
+	if err != nil || selection < 1 || selection > n {
+		return nil, fmt.Errorf("invalid selection")
 	}
+	return []int{selection - 1}, nil
+}
 
-	return items[selection-1].TrashPath, nil
+// highlight marks fuzzy-matched characters in bold when writing to a
+// terminal, unless NO_COLOR is set
+func (u *BasicUI) highlight(s string, positions []int) string {
+	if !u.styled {
+		return s
+	}
+	return Highlight(s, positions, "\x1b[1m", "\x1b[22m")
 }
 
 // Success displays a success message
@@ -114,10 +199,3 @@ func formatSize(bytes int64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
-
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen-3] + "..."
-}
@@ -0,0 +1,310 @@
+package ui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cj3636/GoCycled/pkg/trash"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	events := decodeKeys([]byte("a\x1b[A\x1b[6~\r\x1b\x7fé"))
+
+	expected := []keyEvent{
+		{code: keyRune, r: 'a'},
+		{code: keyUp},
+		{code: keyPgDn},
+		{code: keyEnter},
+		{code: keyEsc},
+		{code: keyBackspace},
+		{code: keyRune, r: 'é'},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %v, got %v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestSortItems(t *testing.T) {
+	now := time.Now()
+	items := []trash.Item{
+		{OriginalPath: "/b", DeletedAt: now.Add(-2 * time.Hour), Size: 10},
+		{OriginalPath: "/a", DeletedAt: now, Size: 5},
+		{OriginalPath: "/c", DeletedAt: now.Add(-time.Hour), Size: 20},
+	}
+
+	tests := []struct {
+		field    SortField
+		reverse  bool
+		expected []string
+	}{
+		{SortByDate, false, []string{"/a", "/c", "/b"}},
+		{SortBySize, false, []string{"/c", "/b", "/a"}},
+		{SortByPath, false, []string{"/a", "/b", "/c"}},
+		{SortByPath, true, []string{"/c", "/b", "/a"}},
+	}
+
+	for _, tt := range tests {
+		SortItems(items, tt.field, tt.reverse)
+		for i, path := range tt.expected {
+			if items[i].OriginalPath != path {
+				t.Errorf("Sort by %s (reverse=%v): position %d expected %s, got %s",
+					tt.field, tt.reverse, i, path, items[i].OriginalPath)
+			}
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+		wantErr  bool
+	}{
+		{"3", []int{2}, false},
+		{"1-3,7", []int{0, 1, 2, 6}, false},
+		{"8-", []int{7, 8, 9}, false},
+		{"-2", []int{0, 1}, false},
+		{"all", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, false},
+		{"!4", []int{0, 1, 2, 4, 5, 6, 7, 8, 9}, false},
+		{"1-5,!2-3", []int{0, 3, 4}, false},
+		{"2 4", []int{1, 3}, false},
+		{"", nil, true},
+		{"0", nil, true},
+		{"11", nil, true},
+		{"5-2", nil, true},
+		{"abc", nil, true},
+		{"!all", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSelection(tt.input, 10)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSelection(%q) should fail, got %v", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSelection(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parseSelection(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	m, ok := FuzzyMatch("cfg", "/home/user/config.yaml")
+	if !ok {
+		t.Fatal("Expected cfg to match config.yaml")
+	}
+	if !reflect.DeepEqual(m.Positions, []int{11, 14, 16}) {
+		t.Errorf("Unexpected positions: %v", m.Positions)
+	}
+
+	if _, ok := FuzzyMatch("xyz", "/home/user/config.yaml"); ok {
+		t.Error("xyz should not match")
+	}
+
+	// Smart case: upper case in the query makes matching case-sensitive
+	if _, ok := FuzzyMatch("Config", "/home/user/config.yaml"); ok {
+		t.Error("Config should not match config.yaml")
+	}
+
+	// Every space-separated term must match
+	if _, ok := FuzzyMatch("user yaml", "/home/user/config.yaml"); !ok {
+		t.Error("Both terms should match")
+	}
+	if _, ok := FuzzyMatch("user json", "/home/user/config.yaml"); ok {
+		t.Error("json should not match")
+	}
+
+	// Consecutive matches at a segment start beat scattered ones
+	tight, _ := FuzzyMatch("main", "/src/main.go")
+	loose, _ := FuzzyMatch("main", "/mail/admin.go")
+	if tight.Score <= loose.Score {
+		t.Errorf("Expected %d > %d", tight.Score, loose.Score)
+	}
+}
+
+func TestMatcherRank(t *testing.T) {
+	now := time.Now()
+	items := []trash.Item{
+		{OriginalPath: "/other/notes.txt", DeletedAt: now.Add(-90 * 24 * time.Hour)},
+		{OriginalPath: "/work/notes.txt", DeletedAt: now.Add(-90 * 24 * time.Hour)},
+		{OriginalPath: "/work/readme.md", DeletedAt: now},
+		{OriginalPath: "/db/old.sql", DeletedAt: now, Note: "old migration, keep until Q3", Tags: []string{"db"}},
+	}
+	m := &Matcher{Now: now, Cwd: "/work"}
+
+	ranked := m.Rank(items, "notes")
+	if len(ranked) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(ranked))
+	}
+	if ranked[0].Item.OriginalPath != "/work/notes.txt" {
+		t.Errorf("Item in the working directory should rank first, got %s", ranked[0].Item.OriginalPath)
+	}
+
+	// Notes are searched when the path does not match
+	ranked = m.Rank(items, "migration")
+	if len(ranked) != 1 || ranked[0].Index != 3 || ranked[0].Match.Positions != nil {
+		t.Errorf("Expected old.sql to match by its note, got %+v", ranked)
+	}
+
+	// An empty query keeps every item in order
+	all := m.Rank(items, "")
+	if len(all) != 4 || all[0].Index != 0 || all[3].Index != 3 {
+		t.Errorf("Empty query should keep order, got %v", all)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("abcd", []int{1, 2}, "[", "]")
+	if got != "a[bc]d" {
+		t.Errorf("Expected a[bc]d, got %s", got)
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		input    string
+		max      int
+		expected string
+	}{
+		{"/short/path.txt", 40, "/short/path.txt"},
+		{"/home/user/projects/app/src/main.go", 25, "/home/us…/app/src/main.go"},
+		{"/home/user/a_really_long_file_name.txt", 12, "…le_name.txt"},
+		{"/home/user/file.txt", 1, "…"},
+		{"/home/user/file.txt", 0, ""},
+		{"", 0, ""},
+	}
+
+	for _, tt := range tests {
+		got := TruncateMiddle(tt.input, tt.max)
+		if got != tt.expected {
+			t.Errorf("TruncateMiddle(%q, %d) = %q, expected %q", tt.input, tt.max, got, tt.expected)
+		}
+		if n := len([]rune(got)); n > tt.max {
+			t.Errorf("TruncateMiddle(%q, %d) is %d runes long", tt.input, tt.max, n)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		ago      time.Duration
+		expected string
+	}{
+		{10 * time.Second, "just now"},
+		{5 * time.Minute, "5m ago"},
+		{3 * time.Hour, "3h ago"},
+		{2 * 24 * time.Hour, "2d ago"},
+		{21 * 24 * time.Hour, "3w ago"},
+		{400 * 24 * time.Hour, "1y ago"},
+	}
+
+	for _, tt := range tests {
+		if got := RelativeTime(now.Add(-tt.ago), now); got != tt.expected {
+			t.Errorf("RelativeTime(%v ago) = %q, expected %q", tt.ago, got, tt.expected)
+		}
+	}
+}
+
+func TestTimeLeft(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		left     time.Duration
+		expected string
+	}{
+		{-time.Minute, "expired"},
+		{10 * time.Second, "1m left"},
+		{3 * time.Hour, "3h left"},
+		{2 * 24 * time.Hour, "2d left"},
+		{90 * 24 * time.Hour, "12w left"},
+	}
+
+	for _, tt := range tests {
+		if got := TimeLeft(now.Add(tt.left), now); got != tt.expected {
+			t.Errorf("TimeLeft(%v) = %q, expected %q", tt.left, got, tt.expected)
+		}
+	}
+
+	// Items without their own expiry follow the bin's retention
+	items := []trash.Item{
+		{OriginalPath: "/tmp/a", DeletedAt: now, ExpiresAt: now.Add(2 * 24 * time.Hour)},
+		{OriginalPath: "/tmp/b", DeletedAt: now.Add(-24 * time.Hour)},
+		{OriginalPath: "/tmp/c", DeletedAt: now, Pinned: true},
+	}
+	var buf strings.Builder
+	RenderTable(&buf, items, TableOptions{Columns: []Column{ColumnPath, ColumnExpires}, Now: now, Retention: 30 * 24 * time.Hour})
+	for _, want := range []string{"2d left", "4w left", "never"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns("id, path,size")
+	if err != nil {
+		t.Fatalf("ParseColumns failed: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []Column{ColumnID, ColumnPath, ColumnSize}) {
+		t.Errorf("Unexpected columns: %v", columns)
+	}
+
+	if _, err := ParseColumns("path,owner"); err == nil {
+		t.Error("ParseColumns should reject unknown columns")
+	}
+}
+
+func TestRenderTableWidth(t *testing.T) {
+	items := []trash.Item{
+		{OriginalPath: "/home/user/projects/app/src/components/widgets/button.tsx", DeletedAt: time.Now(), Size: 2048},
+	}
+
+	var buf strings.Builder
+	RenderTable(&buf, items, TableOptions{Columns: DefaultColumns, Width: 60})
+
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		if n := len([]rune(line)); n > 60 {
+			t.Errorf("Line is %d runes wide: %q", n, line)
+		}
+	}
+	if !strings.Contains(buf.String(), "button.tsx") {
+		t.Errorf("File name should stay visible:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Error("Output should not contain escape sequences when color is off")
+	}
+}
+
+func TestPreviewEncrypted(t *testing.T) {
+	locked := trash.Item{TrashPath: "/trash/files/3f9a", Compression: trash.CompressionSealed, Locked: true, StoredSize: 2048}
+	lines := strings.Join(previewLines(locked, 10), "\n")
+	if !strings.Contains(lines, "[encrypted] 3f9a") || !strings.Contains(lines, "2.0 KB on disk") {
+		t.Errorf("Locked item should show its ID and stored size:\n%s", lines)
+	}
+	if strings.Contains(lines, "0001") || strings.Contains(lines, "compressed") {
+		t.Errorf("Locked item should not show a zero date or compression:\n%s", lines)
+	}
+
+	sealed := locked
+	sealed.Locked = false
+	sealed.OriginalPath = "/home/user/prod.env"
+	sealed.DeletedAt = time.Now()
+	lines = strings.Join(previewLines(sealed, 10), "\n")
+	if !strings.Contains(lines, "prod.env") || !strings.Contains(lines, "(encrypted") || strings.Contains(lines, "compressed") {
+		t.Errorf("Sealed item should be labelled encrypted:\n%s", lines)
+	}
+}